@@ -0,0 +1,131 @@
+// Code generated by protoc-gen-go-traced. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-traced v1.0.0
+// - protoc             v4.25.8
+// source: proto/admin.proto
+
+package admin
+
+import (
+	context "context"
+	grpctrace "github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	attribute "go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+	grpc "google.golang.org/grpc"
+)
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *MethodRule) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *SamplingConfig) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *GetSamplingRequest) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *MethodRules) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *SetSamplingRequest) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *GetLogLevelRequest) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *LogLevel) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+type tracedAdminClient struct {
+	AdminClient
+	w *grpctrace.Wrapper
+}
+
+// NewTracedAdminClient оборачивает клиент так, что каждый unary вызов
+// создает span и передает контекст трассировки серверу. Потоковые методы
+// вызываются без изменений.
+func NewTracedAdminClient(c AdminClient, tracer trace.Tracer, opts ...grpctrace.Option) AdminClient {
+	return &tracedAdminClient{AdminClient: c, w: grpctrace.NewWrapper(tracer, opts...)}
+}
+
+func (c *tracedAdminClient) GetSampling(ctx context.Context, in *GetSamplingRequest, opts ...grpc.CallOption) (*SamplingConfig, error) {
+	ctx, span := c.w.StartClientSpan(ctx, Admin_GetSampling_FullMethodName, in.TraceAttributes()...)
+	out, err := c.AdminClient.GetSampling(ctx, in, opts...)
+	c.w.EndClientSpan(span, Admin_GetSampling_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (c *tracedAdminClient) SetSampling(ctx context.Context, in *SetSamplingRequest, opts ...grpc.CallOption) (*SamplingConfig, error) {
+	ctx, span := c.w.StartClientSpan(ctx, Admin_SetSampling_FullMethodName, in.TraceAttributes()...)
+	out, err := c.AdminClient.SetSampling(ctx, in, opts...)
+	c.w.EndClientSpan(span, Admin_SetSampling_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (c *tracedAdminClient) GetLogLevel(ctx context.Context, in *GetLogLevelRequest, opts ...grpc.CallOption) (*LogLevel, error) {
+	ctx, span := c.w.StartClientSpan(ctx, Admin_GetLogLevel_FullMethodName, in.TraceAttributes()...)
+	out, err := c.AdminClient.GetLogLevel(ctx, in, opts...)
+	c.w.EndClientSpan(span, Admin_GetLogLevel_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (c *tracedAdminClient) SetLogLevel(ctx context.Context, in *LogLevel, opts ...grpc.CallOption) (*LogLevel, error) {
+	ctx, span := c.w.StartClientSpan(ctx, Admin_SetLogLevel_FullMethodName, in.TraceAttributes()...)
+	out, err := c.AdminClient.SetLogLevel(ctx, in, opts...)
+	c.w.EndClientSpan(span, Admin_SetLogLevel_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+type tracedAdminServer struct {
+	AdminServer
+	w *grpctrace.Wrapper
+}
+
+// NewTracedAdminServer оборачивает реализацию сервиса так, что каждый
+// unary вызов создает span, продолжающий trace клиента. Опции те же, что у
+// серверного interceptor: доверие, флаг отладки, часы и политики методов.
+// Потоковые методы вызываются без изменений.
+func NewTracedAdminServer(s AdminServer, tracer trace.Tracer, opts ...grpctrace.Option) AdminServer {
+	return &tracedAdminServer{AdminServer: s, w: grpctrace.NewWrapper(tracer, opts...)}
+}
+
+func (s *tracedAdminServer) GetSampling(ctx context.Context, in *GetSamplingRequest) (*SamplingConfig, error) {
+	ctx, span := s.w.StartServerSpan(ctx, Admin_GetSampling_FullMethodName, in.TraceAttributes()...)
+	out, err := s.AdminServer.GetSampling(ctx, in)
+	s.w.EndServerSpan(ctx, span, Admin_GetSampling_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (s *tracedAdminServer) SetSampling(ctx context.Context, in *SetSamplingRequest) (*SamplingConfig, error) {
+	ctx, span := s.w.StartServerSpan(ctx, Admin_SetSampling_FullMethodName, in.TraceAttributes()...)
+	out, err := s.AdminServer.SetSampling(ctx, in)
+	s.w.EndServerSpan(ctx, span, Admin_SetSampling_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (s *tracedAdminServer) GetLogLevel(ctx context.Context, in *GetLogLevelRequest) (*LogLevel, error) {
+	ctx, span := s.w.StartServerSpan(ctx, Admin_GetLogLevel_FullMethodName, in.TraceAttributes()...)
+	out, err := s.AdminServer.GetLogLevel(ctx, in)
+	s.w.EndServerSpan(ctx, span, Admin_GetLogLevel_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+func (s *tracedAdminServer) SetLogLevel(ctx context.Context, in *LogLevel) (*LogLevel, error) {
+	ctx, span := s.w.StartServerSpan(ctx, Admin_SetLogLevel_FullMethodName, in.TraceAttributes()...)
+	out, err := s.AdminServer.SetLogLevel(ctx, in)
+	s.w.EndServerSpan(ctx, span, Admin_SetLogLevel_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+
+	"github.com/DifferentialOrange/go-tracing-example/sampling"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// logLevels — уровни, которые можно задать; порядок от подробного к строгому
+var logLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// ParseLogLevel разбирает debug, info, warn или error
+func ParseLogLevel(s string) (slog.Level, error) {
+	for _, level := range logLevels {
+		if strings.EqualFold(s, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+// CurrentLogLevel возвращает наименьший уровень, который пишет slog.
+// Вызовы log.Printf от уровня не зависят.
+func CurrentLogLevel() slog.Level {
+	for _, level := range logLevels {
+		if slog.Default().Enabled(context.Background(), level) {
+			return level
+		}
+	}
+	return slog.LevelError
+}
+
+// Service реализует AdminServer поверх семплера и уровня журнала slog.
+// Каждое изменение записывается событием в span вызова и в журнал.
+// Аутентификации у сервиса нет, поэтому слушать его стоит только на
+// loopback адресе.
+type Service struct {
+	UnimplementedAdminServer
+
+	sampler *sampling.Sampler
+}
+
+// NewService создает Service, который меняет sampler
+func NewService(sampler *sampling.Sampler) *Service {
+	return &Service{sampler: sampler}
+}
+
+func (s *Service) GetSampling(ctx context.Context, _ *GetSamplingRequest) (*SamplingConfig, error) {
+	return toProto(s.sampler.Config()), nil
+}
+
+func (s *Service) SetSampling(ctx context.Context, req *SetSamplingRequest) (*SamplingConfig, error) {
+	prev, next, err := s.sampler.Update(func(cfg sampling.Config) sampling.Config {
+		if req.Ratio != nil {
+			cfg.Ratio = req.GetRatio()
+		}
+		if req.Rules != nil {
+			cfg.Rules = nil
+			for _, r := range req.Rules.GetRules() {
+				cfg.Rules = append(cfg.Rules, sampling.Rule{Pattern: r.GetPattern(), Ratio: r.GetRatio()})
+			}
+		}
+		return cfg
+	})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("sampling.updated", trace.WithAttributes(
+		attribute.String("sampling.previous", prev.String()),
+		attribute.String("sampling.current", next.String()),
+	))
+	slog.Info("Sampling changed", "previous", prev.String(), "current", next.String())
+
+	return toProto(next), nil
+}
+
+func (s *Service) GetLogLevel(ctx context.Context, _ *GetLogLevelRequest) (*LogLevel, error) {
+	return &LogLevel{Level: strings.ToLower(CurrentLogLevel().String())}, nil
+}
+
+func (s *Service) SetLogLevel(ctx context.Context, req *LogLevel) (*LogLevel, error) {
+	level, err := ParseLogLevel(req.GetLevel())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	prev := slog.SetLogLoggerLevel(level)
+
+	trace.SpanFromContext(ctx).AddEvent("log_level.updated", trace.WithAttributes(
+		attribute.String("log.level.previous", strings.ToLower(prev.String())),
+		attribute.String("log.level.current", strings.ToLower(level.String())),
+	))
+	log.Printf("Log level changed from %s to %s", prev, level)
+
+	return &LogLevel{Level: strings.ToLower(level.String())}, nil
+}
+
+func toProto(cfg sampling.Config) *SamplingConfig {
+	out := &SamplingConfig{Ratio: cfg.Ratio}
+	for _, r := range cfg.Rules {
+		out.Rules = append(out.Rules, &MethodRule{Pattern: r.Pattern, Ratio: r.Ratio})
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/sampling"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func newService(t *testing.T) (*Service, *sampling.Sampler) {
+	t.Helper()
+	sampler, err := sampling.NewSampler(sampling.Config{Ratio: 1, Rules: []sampling.Rule{{Pattern: "/admin.Admin/*", Ratio: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(sampler), sampler
+}
+
+// withSpan вызывает fn внутри span и возвращает завершенный span
+func withSpan(t *testing.T, fn func(ctx context.Context)) sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "admin")
+	fn(ctx)
+	span.End()
+	return recorder.Ended()[0]
+}
+
+func TestSetSampling(t *testing.T) {
+	svc, sampler := newService(t)
+
+	// Меняем только долю, правила остаются прежними
+	span := withSpan(t, func(ctx context.Context) {
+		got, err := svc.SetSampling(ctx, &SetSamplingRequest{Ratio: proto.Float64(0.25)})
+		if err != nil {
+			t.Fatalf("SetSampling() error = %v", err)
+		}
+		if got.GetRatio() != 0.25 || len(got.GetRules()) != 1 {
+			t.Errorf("SetSampling() = %v", got)
+		}
+	})
+	if cfg := sampler.Config(); cfg.Ratio != 0.25 || len(cfg.Rules) != 1 {
+		t.Errorf("sampler config = %v", cfg)
+	}
+
+	events := span.Events()
+	if len(events) != 1 || events[0].Name != "sampling.updated" {
+		t.Fatalf("events = %v, want sampling.updated", events)
+	}
+	for _, kv := range events[0].Attributes {
+		if kv.Key == "sampling.current" && kv.Value.AsString() != "ratio=0.25 rules=[/admin.Admin/*=1]" {
+			t.Errorf("sampling.current = %q", kv.Value.AsString())
+		}
+	}
+
+	// Пустой список удаляет правила
+	if _, err := svc.SetSampling(context.Background(), &SetSamplingRequest{Rules: &MethodRules{}}); err != nil {
+		t.Fatalf("SetSampling() error = %v", err)
+	}
+	if cfg := sampler.Config(); cfg.Ratio != 0.25 || len(cfg.Rules) != 0 {
+		t.Errorf("sampler config after clearing rules = %v", cfg)
+	}
+}
+
+func TestSetSamplingInvalid(t *testing.T) {
+	svc, sampler := newService(t)
+
+	span := withSpan(t, func(ctx context.Context) {
+		_, err := svc.SetSampling(ctx, &SetSamplingRequest{
+			Ratio: proto.Float64(0),
+			Rules: &MethodRules{Rules: []*MethodRule{{Pattern: "/hello.Greeter/*", Ratio: 2}}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("SetSampling() error = %v, want InvalidArgument", err)
+		}
+	})
+
+	// Ни доля, ни правила не изменились
+	if cfg := sampler.Config(); cfg.Ratio != 1 || len(cfg.Rules) != 1 {
+		t.Errorf("sampler config = %v", cfg)
+	}
+	if len(span.Events()) != 0 {
+		t.Errorf("events = %v, want none", span.Events())
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	svc, _ := newService(t)
+	prev := slog.SetLogLoggerLevel(slog.LevelInfo)
+	t.Cleanup(func() { slog.SetLogLoggerLevel(prev) })
+
+	span := withSpan(t, func(ctx context.Context) {
+		if _, err := svc.SetLogLevel(ctx, &LogLevel{Level: "debug"}); err != nil {
+			t.Fatalf("SetLogLevel() error = %v", err)
+		}
+	})
+	got, err := svc.GetLogLevel(context.Background(), &GetLogLevelRequest{})
+	if err != nil || got.GetLevel() != "debug" {
+		t.Errorf("GetLogLevel() = %v, %v, want debug", got, err)
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != "log_level.updated" {
+		t.Errorf("events = %v, want log_level.updated", events)
+	}
+
+	if _, err := svc.SetLogLevel(context.Background(), &LogLevel{Level: "verbose"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetLogLevel(verbose) error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package balancing распределяет вызовы клиента между несколькими
+// экземплярами сервера: резолверы static:/// и file:/// отдают gRPC список
+// адресов, а ServiceConfig выбирает политику балансировки.
+package balancing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	// Регистрирует политику least_request_experimental
+	_ "google.golang.org/grpc/balancer/leastrequest"
+	"google.golang.org/grpc/resolver"
+)
+
+const (
+	// StaticScheme — адреса в самом target: static:///host1:port,host2:port
+	StaticScheme = "static"
+	// FileScheme — адреса в файле, который резолвер перечитывает при
+	// изменении: file:///path/to/endpoints (см. NewFileBuilder)
+	FileScheme = "file"
+)
+
+// Политики балансировки для ServiceConfig
+const (
+	PickFirst    = "pick_first"
+	RoundRobin   = "round_robin"
+	LeastRequest = "least_request"
+)
+
+// ServiceConfig возвращает JSON service config для grpc.WithDefaultServiceConfig
+// с политикой policy. least_request выбирает из двух случайных адресов тот,
+// где меньше незавершенных вызовов.
+func ServiceConfig(policy string) (string, error) {
+	switch policy {
+	case PickFirst, RoundRobin:
+		return fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy), nil
+	case LeastRequest:
+		return `{"loadBalancingConfig":[{"least_request_experimental":{"choiceCount":2}}]}`, nil
+	}
+	return "", fmt.Errorf("unknown balancing policy %q, want %s, %s or %s", policy, PickFirst, RoundRobin, LeastRequest)
+}
+
+// ParseAddresses разбирает адреса host:port, разделенные запятыми или
+// переводами строк. Пустые строки и строки, начинающиеся с #, пропускаются.
+func ParseAddresses(list string) ([]string, error) {
+	var addrs []string
+	for _, line := range strings.Split(list, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, addr := range strings.Split(line, ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	return addrs, nil
+}
+
+func newState(addrs []string) resolver.State {
+	state := resolver.State{Addresses: make([]resolver.Address, len(addrs))}
+	for i, addr := range addrs {
+		state.Addresses[i] = resolver.Address{Addr: addr}
+	}
+	return state
+}
+
+// NewStaticBuilder возвращает резолвер схемы static для grpc.WithResolvers
+func NewStaticBuilder() resolver.Builder {
+	return staticBuilder{}
+}
+
+type staticBuilder struct{}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := ParseAddresses(target.Endpoint())
+	if err != nil {
+		return nil, fmt.Errorf("static resolver: %w", err)
+	}
+	if err := cc.UpdateState(newState(addrs)); err != nil {
+		return nil, fmt.Errorf("static resolver: %w", err)
+	}
+	return staticResolver{}, nil
+}
+
+func (staticBuilder) Scheme() string { return StaticScheme }
+
+// staticResolver ничего не делает: адреса не меняются
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
@@ -0,0 +1,203 @@
+package balancing_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/balancing"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+)
+
+// greeter отвечает адресом, на котором принят вызов
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(ctx context.Context, _ *pb.HelloRequest) (*pb.HelloResponse, error) {
+	p, _ := peer.FromContext(ctx)
+	return &pb.HelloResponse{Message: p.LocalAddr.String()}, nil
+}
+
+// startServers запускает n экземпляров сервера и возвращает их адреса
+func startServers(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, n)
+	for i := range addrs {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		srv := grpc.NewServer()
+		pb.RegisterGreeterServer(srv, greeter{})
+		go func() { _ = srv.Serve(lis) }()
+		t.Cleanup(srv.Stop)
+		addrs[i] = lis.Addr().String()
+	}
+	return addrs
+}
+
+// reachAll вызывает сервер, пока каждый из addrs не примет хотя бы один
+// вызов. Подключения к экземплярам готовы не одновременно, и первые вызовы
+// могут прийти на один адрес.
+func reachAll(t *testing.T, target, policy string, addrs []string) {
+	t.Helper()
+	serviceConfig, err := balancing.ServiceConfig(policy)
+	if err != nil {
+		t.Fatalf("ServiceConfig(%q): %v", policy, err)
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(balancing.NewStaticBuilder(), balancing.NewFileBuilder()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient(%q): %v", target, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewGreeterClient(conn)
+	got := make(map[string]int)
+	for len(got) < len(addrs) {
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "test"}, grpc.WaitForReady(true))
+		if err != nil {
+			t.Fatalf("SayHello: %v (calls so far: %v, want all of %v)", err, got, addrs)
+		}
+		got[resp.Message]++
+	}
+	for addr := range got {
+		if !slices.Contains(addrs, addr) {
+			t.Errorf("call to unexpected address %s", addr)
+		}
+	}
+}
+
+func TestStaticRoundRobin(t *testing.T) {
+	addrs := startServers(t, 3)
+	reachAll(t, "static:///"+strings.Join(addrs, ","), balancing.RoundRobin, addrs)
+}
+
+func TestFileLeastRequest(t *testing.T) {
+	addrs := startServers(t, 2)
+	file := filepath.Join(t.TempDir(), "endpoints")
+	content := "# greeter instances\n" + strings.Join(addrs, "\n") + "\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reachAll(t, "file://"+file, balancing.LeastRequest, addrs)
+}
+
+func TestParseAddresses(t *testing.T) {
+	got, err := balancing.ParseAddresses("localhost:50051, localhost:50052\n# comment\n\n127.0.0.1:50053\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"localhost:50051", "localhost:50052", "127.0.0.1:50053"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ParseAddresses() = %v, want %v", got, want)
+	}
+
+	for _, list := range []string{"", "# only comment", "localhost"} {
+		if _, err := balancing.ParseAddresses(list); err == nil {
+			t.Errorf("ParseAddresses(%q) succeeded, want error", list)
+		}
+	}
+}
+
+func TestServiceConfigUnknownPolicy(t *testing.T) {
+	if _, err := balancing.ServiceConfig("random"); err == nil {
+		t.Error("ServiceConfig(random) succeeded, want error")
+	}
+}
+
+func TestFileWatch(t *testing.T) {
+	addrs := startServers(t, 2)
+	file := filepath.Join(t.TempDir(), "endpoints.json")
+	writeEndpoints := func(content string) {
+		t.Helper()
+		// Запись через переименование: резолвер не увидит файл наполовину
+		tmp := file + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeEndpoints(`["` + addrs[0] + `"]`)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(context.Background())
+
+	conn, err := grpc.NewClient("file://"+file,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(balancing.NewFileBuilder(
+			balancing.WithPollInterval(10*time.Millisecond),
+			balancing.WithTracer(tp.Tracer("test")),
+		)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := pb.NewGreeterClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	call := func() string {
+		t.Helper()
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "test"}, grpc.WaitForReady(true))
+		if err != nil {
+			t.Fatalf("SayHello: %v", err)
+		}
+		return resp.Message
+	}
+	if got := call(); got != addrs[0] {
+		t.Fatalf("call went to %s, want %s", got, addrs[0])
+	}
+
+	// Испорченный файл не меняет адреса
+	writeEndpoints(`{"endpoints": [`)
+	time.Sleep(50 * time.Millisecond)
+	if got := call(); got != addrs[0] {
+		t.Fatalf("call after broken file went to %s, want %s", got, addrs[0])
+	}
+
+	// Новый набор адресов подхватывается без переподключения
+	writeEndpoints(`{"endpoints": ["` + addrs[1] + `"]}`)
+	for call() != addrs[1] {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var events []sdktrace.Event
+	for _, s := range recorder.Ended() {
+		if s.Name() == "balancing.endpoints" {
+			events = append(events, s.Events()...)
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d endpoints.updated events, want 2: %v", len(events), events)
+	}
+	last := make(map[attribute.Key][]string)
+	for _, kv := range events[1].Attributes {
+		last[kv.Key] = kv.Value.AsStringSlice()
+	}
+	if !slices.Equal(last["endpoints.added"], addrs[1:]) || !slices.Equal(last["endpoints.removed"], addrs[:1]) {
+		t.Errorf("endpoints.updated attributes = %v, want added %v and removed %v", last, addrs[1:], addrs[:1])
+	}
+}
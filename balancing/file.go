@@ -0,0 +1,216 @@
+package balancing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/resolver"
+)
+
+// DefaultPollInterval — как часто резолвер file проверяет файл по умолчанию
+const DefaultPollInterval = time.Second
+
+// Option настраивает резолвер file
+type Option func(*fileBuilder)
+
+// WithPollInterval задает, как часто проверять файл с адресами
+func WithPollInterval(interval time.Duration) Option {
+	return func(b *fileBuilder) { b.interval = interval }
+}
+
+// WithTracer задает tracer для span об изменении адресов; по умолчанию
+// берется из глобального TracerProvider
+func WithTracer(tracer trace.Tracer) Option {
+	return func(b *fileBuilder) { b.tracer = tracer }
+}
+
+// NewFileBuilder возвращает резолвер схемы file для grpc.WithResolvers.
+// Файл содержит адреса через запятую или по одному на строку, либо JSON:
+// список адресов или объект {"endpoints": [...]}. Резолвер проверяет файл
+// раз в интервал и сразу, когда gRPC просит обновить адреса, и передает
+// соединению новый список, как только набор адресов изменился. Каждое
+// изменение пишется в лог и в span "balancing.endpoints" с событием
+// endpoints.updated. Если файл пропал или испорчен, соединение продолжает
+// работать с прежними адресами.
+func NewFileBuilder(opts ...Option) resolver.Builder {
+	b := fileBuilder{interval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return b
+}
+
+type fileBuilder struct {
+	interval time.Duration
+	tracer   trace.Tracer
+}
+
+func (b fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	tracer := b.tracer
+	if tracer == nil {
+		tracer = otel.Tracer("github.com/DifferentialOrange/go-tracing-example/balancing")
+	}
+	r := &fileResolver{
+		path:   target.URL.Path,
+		cc:     cc,
+		tracer: tracer,
+		now:    make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	// Первое чтение синхронно, чтобы вызовы не ждали первого тика
+	r.resolve()
+
+	r.wg.Add(1)
+	go r.watch(b.interval)
+	return r, nil
+}
+
+func (fileBuilder) Scheme() string { return FileScheme }
+
+type fileResolver struct {
+	path   string
+	cc     resolver.ClientConn
+	tracer trace.Tracer
+
+	now  chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// Используются только в resolve: из Build и затем из горутины watch
+	addrs   []string
+	lastErr string
+}
+
+func (r *fileResolver) watch(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.now:
+		case <-r.done:
+			return
+		}
+		r.resolve()
+	}
+}
+
+// resolve читает файл и передает адреса соединению, если набор изменился
+func (r *fileResolver) resolve() {
+	addrs, err := readEndpoints(r.path)
+	if err != nil {
+		// Одна и та же ошибка повторяется на каждом тике, пишем ее один раз
+		if err.Error() != r.lastErr {
+			log.Printf("file resolver: %v; keeping %d endpoints", err, len(r.addrs))
+			r.lastErr = err.Error()
+		}
+		r.cc.ReportError(err)
+		return
+	}
+	r.lastErr = ""
+
+	slices.Sort(addrs)
+	addrs = slices.Compact(addrs)
+	if slices.Equal(addrs, r.addrs) {
+		return
+	}
+
+	added, removed := diff(r.addrs, addrs)
+	log.Printf("file resolver: %s: endpoints changed to %v (added %v, removed %v)", r.path, addrs, added, removed)
+
+	// Отдельный span: изменение не относится ни к одному вызову
+	_, span := r.tracer.Start(context.Background(), "balancing.endpoints",
+		trace.WithAttributes(attribute.String("balancing.file", r.path)),
+	)
+	defer span.End()
+	span.AddEvent("endpoints.updated", trace.WithAttributes(
+		attribute.StringSlice("endpoints.previous", r.addrs),
+		attribute.StringSlice("endpoints.current", addrs),
+		attribute.StringSlice("endpoints.added", added),
+		attribute.StringSlice("endpoints.removed", removed),
+	))
+
+	r.addrs = addrs
+	if err := r.cc.UpdateState(newState(addrs)); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("file resolver: %s: connection rejected endpoints: %v", r.path, err)
+	}
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+// readEndpoints читает адреса из файла в одном из форматов NewFileBuilder
+func readEndpoints(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, "[") && !strings.HasPrefix(content, "{") {
+		addrs, err := ParseAddresses(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return addrs, nil
+	}
+
+	var list []string
+	if strings.HasPrefix(content, "{") {
+		var obj struct {
+			Endpoints []string `json:"endpoints"`
+		}
+		err = json.Unmarshal(data, &obj)
+		list = obj.Endpoints
+	} else {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	addrs, err := ParseAddresses(strings.Join(list, ","))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return addrs, nil
+}
+
+// diff возвращает адреса, которые есть только в next, и только в prev;
+// оба списка отсортированы
+func diff(prev, next []string) (added, removed []string) {
+	for _, addr := range next {
+		if _, found := slices.BinarySearch(prev, addr); !found {
+			added = append(added, addr)
+		}
+	}
+	for _, addr := range prev {
+		if _, found := slices.BinarySearch(next, addr); !found {
+			removed = append(removed, addr)
+		}
+	}
+	return added, removed
+}
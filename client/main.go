@@ -2,16 +2,29 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/DifferentialOrange/go-tracing-example/admin"
+	"github.com/DifferentialOrange/go-tracing-example/balancing"
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	"github.com/DifferentialOrange/go-tracing-example/hedging"
 	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"github.com/DifferentialOrange/go-tracing-example/otelconfig"
+	"github.com/DifferentialOrange/go-tracing-example/repro"
+	"github.com/DifferentialOrange/go-tracing-example/sampling"
+	"github.com/DifferentialOrange/go-tracing-example/selfobs"
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"github.com/DifferentialOrange/go-tracing-example/tracesetup"
+	"github.com/DifferentialOrange/go-tracing-example/zpages"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
@@ -20,66 +33,98 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
-func initTracer(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
-	// Создаем OTEL exporter
-	exporter, err := otlptracehttp.New(ctx)
-	if err != nil {
-		return nil, err
-	}
+func startDebugServer(addr string, zp *zpages.SpanProcessor) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/tracez", zpages.Handler(zp))
+	// Профили размечены метками span_id и rpc.method, см. grpctrace.SpanIDLabel
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
-	// Создаем TracerProvider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(serviceName),
-		)),
-	)
-
-	// Устанавливаем глобальный TracerProvider и propagator
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	go func() {
+		log.Printf("Debug server started on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("debug server stopped: %v", err)
+		}
+	}()
+}
 
-	return tp, nil
+// envOr возвращает значение переменной окружения или def, если она не задана
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }
 
-func injectSpanContext(ctx context.Context) context.Context {
-	// Создаем carrier для передачи контекста
-	carrier := metadataTextMap{}
-	propagator := otel.GetTextMapPropagator()
-	propagator.Inject(ctx, carrier)
+func main() {
+	traceURL := flag.String("trace-url", "http://localhost:16686/trace/{trace_id}",
+		"Jaeger UI URL template, {trace_id} is replaced with the trace id returned by the server")
+	debugAddr := flag.String("debug-addr", "", "address of the debug HTTP server with /debug/tracez, disabled when empty")
+	tenantID := flag.String("tenant", "", "tenant id sent to the server in metadata and baggage")
+	bufferDir := flag.String("span-buffer-dir", "", "directory to keep spans in while the collector is unreachable, disabled when empty")
+	capturePayloads := flag.Bool("capture-payloads", false, "record request and response messages as JSON span events")
+	payloadMaxSize := flag.Int("payload-max-size", grpctrace.DefaultPayloadMaxSize, "maximum size of a captured message in bytes")
+	redactFields := flag.String("redact-fields", "", "comma-separated message fields hidden in captured payloads and policy attributes, e.g. name,user.token")
+	traceSeed := flag.Int64("trace-seed", 0, "seed for reproducible trace ids and a simulated clock, random ids and real time when 0")
+	propagators := flag.String("propagators", envOr("OTEL_PROPAGATORS", "tracecontext,baggage"),
+		"trace context propagators: tracecontext, baggage, grpc-trace-bin; the first listed wins when a request carries several")
+	otelConfig := flag.String("otel-config", os.Getenv("OTEL_CONFIG_FILE"), "declarative OpenTelemetry configuration file (YAML) used instead of the OTEL_EXPORTER_OTLP_* variables")
+	target := flag.String("target", "localhost:50051", "server address; static:///host1:port,host2:port lists several instances, file:///path reads them from a file and follows its changes")
+	lbPolicy := flag.String("lb", balancing.RoundRobin, "load balancing policy across server instances: round_robin, least_request or pick_first")
+	hedgeAttempts := flag.Int("hedge-attempts", 1, "maximum number of concurrent attempts of each call; more than 1 enables hedging")
+	hedgeDelay := flag.Duration("hedge-delay", 150*time.Millisecond, "send the next hedged attempt if no response arrived within this time")
+	requests := flag.Int("requests", 1, "number of SayHello calls, each in its own trace")
+	debugTrace := flag.String("debug-trace", "", "send x-debug-trace with this value (a token accepted by the server) to sample the whole trace")
+	flag.Parse()
 
-	return metadata.NewOutgoingContext(ctx, metadata.MD(carrier))
-}
+	// Ошибки SDK пишем в наш лог вместо глобального обработчика по умолчанию
+	selfobs.InstallErrorHandler()
 
-type metadataTextMap metadata.MD
+	// С seed идентификаторы и время span повторяются от запуска к запуску
+	tracerOpts, clock := repro.TracerProviderOptions(*traceSeed)
 
-func (m metadataTextMap) Get(key string) string {
-	values := m[key]
-	if len(values) == 0 {
-		return ""
+	// Опционально включаем отладочные страницы со span в памяти
+	if *debugAddr != "" {
+		zp := zpages.NewSpanProcessor(zpages.DefaultSampleSize)
+		tracerOpts = append(tracerOpts, sdktrace.WithSpanProcessor(zp))
+		startDebugServer(*debugAddr, zp)
 	}
-	return values[0]
-}
 
-func (m metadataTextMap) Set(key, value string) {
-	m[key] = []string{value}
-}
+	// Старые сервисы передают контекст только в бинарном grpc-trace-bin
+	propagator, err := grpctrace.ParsePropagators(*propagators)
+	if err != nil {
+		log.Fatalf("Invalid -propagators: %v", err)
+	}
 
-func (m metadataTextMap) Keys() []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+	// Экспортеры, семплер и ресурс можно описать в файле вместо переменных окружения
+	var fileConfig *otelconfig.Config
+	if *otelConfig != "" {
+		fileConfig, err = otelconfig.Load(*otelConfig)
+		if err != nil {
+			log.Fatalf("Invalid -otel-config: %v", err)
+		}
+	}
+
+	// С флагом отладки trace семплируется независимо от доли
+	if *debugTrace != "" {
+		var sampler sdktrace.Sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+		if fileConfig != nil && fileConfig.Sampler() != nil {
+			sampler = fileConfig.Sampler()
+		}
+		tracerOpts = append(tracerOpts, sdktrace.WithSampler(grpctrace.DebugSampler(sampler)))
 	}
-	return keys
-}
 
-func main() {
 	// Инициализируем tracer provider
-	tp, err := initTracer(context.Background(), "grpc-client")
+	tp, err := tracesetup.Init(context.Background(), tracesetup.Config{
+		ServiceName: "grpc-client",
+		BufferDir:   *bufferDir,
+		FileConfig:  fileConfig,
+		Propagator:  propagator,
+		Options:     tracerOpts,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
@@ -89,6 +134,22 @@ func main() {
 		}
 	}()
 
+	// Инициализируем meter provider
+	mp, err := initMeter(context.Background(), "grpc-client")
+	if err != nil {
+		log.Fatalf("Failed to initialize meter: %v", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
+
+	metrics, err := grpctrace.NewClientMetrics(mp.Meter("grpc-client"))
+	if err != nil {
+		log.Fatalf("Failed to create metrics: %v", err)
+	}
+
 	// Получаем tracer
 	tracer := otel.GetTracerProvider().Tracer(
 		"grpc-client",
@@ -96,11 +157,45 @@ func main() {
 		trace.WithSchemaURL(semconv.SchemaURL),
 	)
 
-	// Установка соединения с сервером
-	conn, err := grpc.Dial("localhost:50051",
+	traceOpts := []grpctrace.Option{grpctrace.WithClock(clock)}
+	// Скрытые поля не попадают ни в события, ни в атрибуты политик
+	capture := tracesetup.PayloadCapture(*payloadMaxSize, *redactFields)
+	traceOpts = append(traceOpts, grpctrace.WithRedactFields(capture.Redact...))
+	if *capturePayloads {
+		traceOpts = append(traceOpts, grpctrace.WithPayloadCapture(capture))
+	}
+
+	// Команда admin меняет настройки сервера вместо приветствия
+	if flag.Arg(0) == "admin" {
+		runAdmin(flag.Args()[1:], tracer, metrics, traceOpts)
+		return
+	}
+
+	// Установка соединения с сервером; адрес экземпляра для каждого вызова
+	// выбирает балансировщик, а client span записывает его в net.sock.peer.addr
+	serviceConfig, err := balancing.ServiceConfig(*lbPolicy)
+	if err != nil {
+		log.Fatalf("Invalid -lb: %v", err)
+	}
+	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(tracingUnaryClientInterceptor(tracer)),
-	)
+		grpc.WithResolvers(balancing.NewStaticBuilder(), balancing.NewFileBuilder(balancing.WithTracer(tracer))),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithStatsHandler(grpctrace.NewClientHandler(tracer, metrics, append(traceOpts, grpctrace.WithPeerName(*target))...)),
+	}
+
+	// При hedging каждая попытка — отдельный вызов со своим client span,
+	// балансировщик может отправить попытки на разные экземпляры
+	hedgePolicy := hedging.Policy{MaxAttempts: *hedgeAttempts, Delay: *hedgeDelay}
+	if err := hedgePolicy.Validate(); err != nil {
+		log.Fatalf("Invalid -hedge-delay: %v", err)
+	}
+	if hedgePolicy.Enabled() {
+		log.Printf("Hedging enabled: %s", hedgePolicy)
+		dialOpts = append(dialOpts, grpc.WithUnaryInterceptor(hedging.UnaryClientInterceptor(tracer, hedgePolicy)))
+	}
+
+	conn, err := grpc.Dial(*target, dialOpts...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -109,81 +204,132 @@ func main() {
 	client := pb.NewGreeterClient(conn)
 
 	// Тест обычного RPC вызова
-	testUnaryRPC(client, tracer)
+	for i := 0; i < *requests; i++ {
+		testUnaryRPC(client, tracer, clock, *target, *traceURL, *tenantID, *debugTrace)
+	}
 }
 
-func testUnaryRPC(client pb.GreeterClient, tracer trace.Tracer) {
-	// Создаем span для клиентского вызова
-	ctx, span := tracer.Start(context.Background(), "client_unary_call")
-	defer span.End()
+func testUnaryRPC(client pb.GreeterClient, tracer trace.Tracer, clock repro.Clock, target, traceURL, tenantID, debugTrace string) {
+	// Создаем span для клиентского вызова от имени арендатора; флаг отладки
+	// с токеном уходит только первому серверу, дальше идет его отметка
+	ctx := tenant.ContextWithTenant(context.Background(), tenantID)
+	ctx = grpctrace.ContextWithDebug(ctx, debugTrace)
+	ctx, span := tracer.Start(ctx, "client_unary_call", trace.WithTimestamp(clock.Now()))
+	defer func() { span.End(trace.WithTimestamp(clock.Now())) }()
 
 	// Добавляем атрибуты
 	span.SetAttributes(
 		attribute.String("client.operation", "unary_call"),
-		attribute.String("grpc.target", "localhost:50051"),
+		attribute.String("grpc.target", target),
 	)
 
 	// Устанавливаем таймаут и внедряем контекст трассировки
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	ctx = injectSpanContext(ctx)
+	ctx = grpctrace.InjectSpanContext(ctx)
 
 	log.Println("Sending unary RPC request...")
-	response, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Go Developer"})
+	var header, trailer metadata.MD
+	response, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Go Developer"},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+	printTraceLink(traceURL, header, trailer)
 	if err != nil {
 		// Обрабатываем ошибку
 		span.SetStatus(codes.Error, err.Error())
-		span.RecordError(err)
+		span.RecordError(err, trace.WithTimestamp(clock.Now()))
 		span.SetAttributes(attribute.Bool("error", true))
 		log.Fatalf("could not greet: %v", err)
 	}
 
 	// Логируем получение ответа
-	span.AddEvent("response_received", trace.WithAttributes(
+	span.AddEvent("response_received", trace.WithTimestamp(clock.Now()), trace.WithAttributes(
 		attribute.String("response.message", response.Message),
 	))
 	log.Printf("Server response: %s", response.Message)
 }
 
-func tracingUnaryClientInterceptor(tracer trace.Tracer) grpc.UnaryClientInterceptor {
-	return func(
-		ctx context.Context,
-		method string,
-		req, reply interface{},
-		cc *grpc.ClientConn,
-		invoker grpc.UnaryInvoker,
-		opts ...grpc.CallOption,
-	) error {
-		// Создаем span для gRPC вызова
-		ctx, span := tracer.Start(ctx, method,
-			trace.WithSpanKind(trace.SpanKindClient),
-		)
-		defer span.End()
-
-		// Добавляем семантические атрибуты
-		span.SetAttributes(
-			attribute.String("rpc.system", "grpc"),
-			attribute.String("rpc.service", "Greeter"),
-			attribute.String("rpc.method", method),
-			attribute.String("grpc.type", "unary"),
-			attribute.String("net.peer.name", cc.Target()),
-		)
-
-		// Внедряем контекст трассировки в исходящие метаданные
-		ctx = injectSpanContext(ctx)
-
-		// Выполняем вызов
-		err := invoker(ctx, method, req, reply, cc, opts...)
-
-		// Обрабатываем результат
-		if err != nil {
-			span.SetStatus(codes.Error, err.Error())
-			span.RecordError(err)
-			span.SetAttributes(attribute.Bool("error", true))
-		} else {
-			span.SetStatus(codes.Ok, "success")
+// runAdmin выполняет "admin [-addr host:port] [-ratio r] [-rules p=r,...]
+// [-log-level l]": применяет заданные настройки и печатает текущие
+func runAdmin(args []string, tracer trace.Tracer, metrics *grpctrace.Metrics, opts []grpctrace.Option) {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:50052", "address of the server Admin service")
+	ratio := fs.Float64("ratio", 1, "new sampling ratio for methods without a rule")
+	rules := fs.String("rules", "", "new per-method sampling rules replacing the current ones, e.g. /hello.Greeter/*=0.1; empty removes all rules")
+	logLevel := fs.String("log-level", "", "new server log level: debug, info, warn or error")
+	_ = fs.Parse(args)
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	conn, err := grpc.Dial(*addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(grpctrace.NewClientHandler(tracer, metrics, append(opts, grpctrace.WithPeerName(*addr))...)),
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	client := admin.NewAdminClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Долю и правила отправляем одним запросом, сервер применяет их вместе
+	if set["ratio"] || set["rules"] {
+		req := &admin.SetSamplingRequest{}
+		if set["ratio"] {
+			req.Ratio = ratio
+		}
+		if set["rules"] {
+			parsed, err := sampling.ParseRules(*rules)
+			if err != nil {
+				log.Fatalf("Invalid -rules: %v", err)
+			}
+			req.Rules = &admin.MethodRules{}
+			for _, r := range parsed {
+				req.Rules.Rules = append(req.Rules.Rules, &admin.MethodRule{Pattern: r.Pattern, Ratio: r.Ratio})
+			}
+		}
+		if _, err := client.SetSampling(ctx, req); err != nil {
+			log.Fatalf("could not set sampling: %v", err)
 		}
+	}
+	if set["log-level"] {
+		if _, err := client.SetLogLevel(ctx, &admin.LogLevel{Level: *logLevel}); err != nil {
+			log.Fatalf("could not set log level: %v", err)
+		}
+	}
+
+	cfg, err := client.GetSampling(ctx, &admin.GetSamplingRequest{})
+	if err != nil {
+		log.Fatalf("could not get sampling: %v", err)
+	}
+	level, err := client.GetLogLevel(ctx, &admin.GetLogLevelRequest{})
+	if err != nil {
+		log.Fatalf("could not get log level: %v", err)
+	}
 
-		return err
+	log.Printf("Sampling ratio: %g", cfg.GetRatio())
+	for _, r := range cfg.GetRules() {
+		log.Printf("Sampling rule: %s=%g", r.GetPattern(), r.GetRatio())
 	}
+	log.Printf("Log level: %s", level.GetLevel())
+}
+
+// printTraceLink выводит trace id, который вернул сервер, и ссылку на него в Jaeger UI
+func printTraceLink(traceURL string, header, trailer metadata.MD) {
+	traceID := grpctrace.MetadataCarrier(header).Get("x-trace-id")
+	if traceID == "" {
+		// При ошибке сервер передает trace id в трейлерах
+		traceID = grpctrace.MetadataCarrier(trailer).Get("x-trace-id")
+	}
+	if traceID == "" {
+		log.Println("Server did not return trace id")
+		return
+	}
+
+	log.Printf("Trace ID: %s", traceID)
+	log.Printf("Trace URL: %s", strings.ReplaceAll(traceURL, "{trace_id}", traceID))
 }
@@ -0,0 +1,350 @@
+package diskbuffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Формат файла на диске: ReadOnlySpan нельзя сериализовать напрямую,
+// поэтому span переводятся в простые структуры и обратно в spanSnapshot
+
+type spanRecord struct {
+	Name              string            `json:"name"`
+	SpanContext       spanContextRecord `json:"span_context"`
+	Parent            spanContextRecord `json:"parent"`
+	Kind              int               `json:"kind"`
+	StartTime         time.Time         `json:"start_time"`
+	EndTime           time.Time         `json:"end_time"`
+	Attributes        []attributeRecord `json:"attributes,omitempty"`
+	Events            []eventRecord     `json:"events,omitempty"`
+	Links             []linkRecord      `json:"links,omitempty"`
+	StatusCode        uint32            `json:"status_code"`
+	StatusDescription string            `json:"status_description,omitempty"`
+	DroppedAttributes int               `json:"dropped_attributes,omitempty"`
+	DroppedEvents     int               `json:"dropped_events,omitempty"`
+	DroppedLinks      int               `json:"dropped_links,omitempty"`
+	ChildSpanCount    int               `json:"child_span_count,omitempty"`
+	Resource          resourceRecord    `json:"resource"`
+	Scope             scopeRecord       `json:"scope"`
+}
+
+type spanContextRecord struct {
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	TraceFlags byte   `json:"trace_flags,omitempty"`
+	TraceState string `json:"trace_state,omitempty"`
+	Remote     bool   `json:"remote,omitempty"`
+}
+
+type attributeRecord struct {
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type eventRecord struct {
+	Name                  string            `json:"name"`
+	Time                  time.Time         `json:"time"`
+	Attributes            []attributeRecord `json:"attributes,omitempty"`
+	DroppedAttributeCount int               `json:"dropped_attributes,omitempty"`
+}
+
+type linkRecord struct {
+	SpanContext           spanContextRecord `json:"span_context"`
+	Attributes            []attributeRecord `json:"attributes,omitempty"`
+	DroppedAttributeCount int               `json:"dropped_attributes,omitempty"`
+}
+
+type resourceRecord struct {
+	SchemaURL  string            `json:"schema_url,omitempty"`
+	Attributes []attributeRecord `json:"attributes,omitempty"`
+}
+
+type scopeRecord struct {
+	Name       string            `json:"name"`
+	Version    string            `json:"version,omitempty"`
+	SchemaURL  string            `json:"schema_url,omitempty"`
+	Attributes []attributeRecord `json:"attributes,omitempty"`
+}
+
+func encodeSpans(spans []sdktrace.ReadOnlySpan) ([]byte, error) {
+	records := make([]spanRecord, 0, len(spans))
+	for _, s := range spans {
+		r, err := encodeSpan(s)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return json.Marshal(records)
+}
+
+func decodeSpans(data []byte) ([]sdktrace.ReadOnlySpan, error) {
+	var records []spanRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	spans := make([]sdktrace.ReadOnlySpan, 0, len(records))
+	for _, r := range records {
+		s, err := decodeSpan(r)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, nil
+}
+
+func encodeSpan(s sdktrace.ReadOnlySpan) (spanRecord, error) {
+	r := spanRecord{
+		Name:              s.Name(),
+		SpanContext:       encodeSpanContext(s.SpanContext()),
+		Parent:            encodeSpanContext(s.Parent()),
+		Kind:              int(s.SpanKind()),
+		StartTime:         s.StartTime(),
+		EndTime:           s.EndTime(),
+		StatusCode:        uint32(s.Status().Code),
+		StatusDescription: s.Status().Description,
+		DroppedAttributes: s.DroppedAttributes(),
+		DroppedEvents:     s.DroppedEvents(),
+		DroppedLinks:      s.DroppedLinks(),
+		ChildSpanCount:    s.ChildSpanCount(),
+		Scope: scopeRecord{
+			Name:      s.InstrumentationScope().Name,
+			Version:   s.InstrumentationScope().Version,
+			SchemaURL: s.InstrumentationScope().SchemaURL,
+		},
+	}
+
+	var err error
+	if r.Attributes, err = encodeAttributes(s.Attributes()); err != nil {
+		return r, err
+	}
+	scopeAttrs := s.InstrumentationScope().Attributes
+	if r.Scope.Attributes, err = encodeAttributes(scopeAttrs.ToSlice()); err != nil {
+		return r, err
+	}
+	if res := s.Resource(); res != nil {
+		r.Resource.SchemaURL = res.SchemaURL()
+		if r.Resource.Attributes, err = encodeAttributes(res.Attributes()); err != nil {
+			return r, err
+		}
+	}
+	for _, e := range s.Events() {
+		attrs, err := encodeAttributes(e.Attributes)
+		if err != nil {
+			return r, err
+		}
+		r.Events = append(r.Events, eventRecord{
+			Name:                  e.Name,
+			Time:                  e.Time,
+			Attributes:            attrs,
+			DroppedAttributeCount: e.DroppedAttributeCount,
+		})
+	}
+	for _, l := range s.Links() {
+		attrs, err := encodeAttributes(l.Attributes)
+		if err != nil {
+			return r, err
+		}
+		r.Links = append(r.Links, linkRecord{
+			SpanContext:           encodeSpanContext(l.SpanContext),
+			Attributes:            attrs,
+			DroppedAttributeCount: l.DroppedAttributeCount,
+		})
+	}
+
+	return r, nil
+}
+
+func decodeSpan(r spanRecord) (sdktrace.ReadOnlySpan, error) {
+	stub := &spanSnapshot{
+		name: r.Name,
+		kind: trace.SpanKind(r.Kind),
+		status: sdktrace.Status{
+			Code:        codes.Code(r.StatusCode),
+			Description: r.StatusDescription,
+		},
+		startTime:         r.StartTime,
+		endTime:           r.EndTime,
+		droppedAttributes: r.DroppedAttributes,
+		droppedEvents:     r.DroppedEvents,
+		droppedLinks:      r.DroppedLinks,
+		childSpanCount:    r.ChildSpanCount,
+	}
+
+	var err error
+	if stub.spanContext, err = decodeSpanContext(r.SpanContext); err != nil {
+		return nil, err
+	}
+	if stub.parent, err = decodeSpanContext(r.Parent); err != nil {
+		return nil, err
+	}
+	if stub.attributes, err = decodeAttributes(r.Attributes); err != nil {
+		return nil, err
+	}
+
+	resAttrs, err := decodeAttributes(r.Resource.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	stub.resource = resource.NewWithAttributes(r.Resource.SchemaURL, resAttrs...)
+
+	scopeAttrs, err := decodeAttributes(r.Scope.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	stub.scope = instrumentation.Scope{
+		Name:       r.Scope.Name,
+		Version:    r.Scope.Version,
+		SchemaURL:  r.Scope.SchemaURL,
+		Attributes: attribute.NewSet(scopeAttrs...),
+	}
+
+	for _, e := range r.Events {
+		attrs, err := decodeAttributes(e.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		stub.events = append(stub.events, sdktrace.Event{
+			Name:                  e.Name,
+			Time:                  e.Time,
+			Attributes:            attrs,
+			DroppedAttributeCount: e.DroppedAttributeCount,
+		})
+	}
+	for _, l := range r.Links {
+		sc, err := decodeSpanContext(l.SpanContext)
+		if err != nil {
+			return nil, err
+		}
+		attrs, err := decodeAttributes(l.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		stub.links = append(stub.links, sdktrace.Link{
+			SpanContext:           sc,
+			Attributes:            attrs,
+			DroppedAttributeCount: l.DroppedAttributeCount,
+		})
+	}
+
+	return stub, nil
+}
+
+func encodeSpanContext(sc trace.SpanContext) spanContextRecord {
+	if !sc.IsValid() {
+		return spanContextRecord{}
+	}
+	return spanContextRecord{
+		TraceID:    sc.TraceID().String(),
+		SpanID:     sc.SpanID().String(),
+		TraceFlags: byte(sc.TraceFlags()),
+		TraceState: sc.TraceState().String(),
+		Remote:     sc.IsRemote(),
+	}
+}
+
+func decodeSpanContext(r spanContextRecord) (trace.SpanContext, error) {
+	if r.TraceID == "" {
+		return trace.SpanContext{}, nil
+	}
+
+	traceID, err := trace.TraceIDFromHex(r.TraceID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+	spanID, err := trace.SpanIDFromHex(r.SpanID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+	traceState, err := trace.ParseTraceState(r.TraceState)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.TraceFlags(r.TraceFlags),
+		TraceState: traceState,
+		Remote:     r.Remote,
+	}), nil
+}
+
+func encodeAttributes(kvs []attribute.KeyValue) ([]attributeRecord, error) {
+	records := make([]attributeRecord, 0, len(kvs))
+	for _, kv := range kvs {
+		value, err := json.Marshal(kv.Value.AsInterface())
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, attributeRecord{
+			Key:   string(kv.Key),
+			Type:  kv.Value.Type().String(),
+			Value: value,
+		})
+	}
+	return records, nil
+}
+
+func decodeAttributes(records []attributeRecord) ([]attribute.KeyValue, error) {
+	kvs := make([]attribute.KeyValue, 0, len(records))
+	for _, r := range records {
+		kv, err := decodeAttribute(r)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", r.Key, err)
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, nil
+}
+
+func decodeAttribute(r attributeRecord) (attribute.KeyValue, error) {
+	key := attribute.Key(r.Key)
+	switch r.Type {
+	case attribute.BOOL.String():
+		var v bool
+		err := json.Unmarshal(r.Value, &v)
+		return key.Bool(v), err
+	case attribute.INT64.String():
+		var v int64
+		err := json.Unmarshal(r.Value, &v)
+		return key.Int64(v), err
+	case attribute.FLOAT64.String():
+		var v float64
+		err := json.Unmarshal(r.Value, &v)
+		return key.Float64(v), err
+	case attribute.STRING.String():
+		var v string
+		err := json.Unmarshal(r.Value, &v)
+		return key.String(v), err
+	case attribute.BOOLSLICE.String():
+		var v []bool
+		err := json.Unmarshal(r.Value, &v)
+		return key.BoolSlice(v), err
+	case attribute.INT64SLICE.String():
+		var v []int64
+		err := json.Unmarshal(r.Value, &v)
+		return key.Int64Slice(v), err
+	case attribute.FLOAT64SLICE.String():
+		var v []float64
+		err := json.Unmarshal(r.Value, &v)
+		return key.Float64Slice(v), err
+	case attribute.STRINGSLICE.String():
+		var v []string
+		err := json.Unmarshal(r.Value, &v)
+		return key.StringSlice(v), err
+	default:
+		return attribute.KeyValue{}, fmt.Errorf("unsupported attribute type %s", r.Type)
+	}
+}
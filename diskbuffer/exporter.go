@@ -0,0 +1,418 @@
+// Package diskbuffer оборачивает SpanExporter так, что пачки span, которые
+// не удалось отправить, сохраняются в каталог на диске и отправляются
+// повторно, когда коллектор снова становится доступен.
+package diskbuffer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Значения Config по умолчанию
+const (
+	DefaultMaxBytes      = 64 << 20
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// Config задает каталог и ограничения буфера
+type Config struct {
+	// Dir — каталог для пачек span, создается при необходимости
+	Dir string
+	// MaxBytes — предельный суммарный размер файлов; при переполнении
+	// удаляются самые старые пачки
+	MaxBytes int64
+	// RetryInterval — период повторной отправки сохраненных пачек
+	RetryInterval time.Duration
+	// MeterProvider для метрик буфера, по умолчанию глобальный
+	MeterProvider metric.MeterProvider
+}
+
+// Stats — счетчики span, прошедших через буфер
+type Stats struct {
+	// Buffered — сколько span сейчас лежит на диске
+	Buffered int64
+	// Dropped — сколько span потеряно из-за ограничения размера или ошибок записи
+	Dropped int64
+	// Replayed — сколько span успешно отправлено с диска
+	Replayed int64
+}
+
+// Exporter сохраняет на диск пачки, которые не принял вложенный экспортер
+type Exporter struct {
+	next sdktrace.SpanExporter
+	cfg  Config
+
+	// mu защищает файлы в каталоге и seq
+	mu  sync.Mutex
+	seq int64
+	// exportMu не дает replayLoop и BatchSpanProcessor вызывать
+	// next.ExportSpans одновременно: SpanExporter не обязан это поддерживать
+	exportMu sync.Mutex
+
+	buffered atomic.Int64
+	dropped  atomic.Int64
+	replayed atomic.Int64
+
+	registration metric.Registration
+	wake         chan struct{}
+	stop         chan struct{}
+	done         chan struct{}
+	stopOnce     sync.Once
+}
+
+var _ sdktrace.SpanExporter = (*Exporter)(nil)
+
+// New создает Exporter поверх next. Пачки, оставшиеся в cfg.Dir с прошлого
+// запуска, будут отправлены повторно, а недописанные временные файлы
+// удаляются.
+func New(next sdktrace.SpanExporter, cfg Config) (*Exporter, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("diskbuffer: directory is required")
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("diskbuffer: %w", err)
+	}
+
+	e := &Exporter{
+		next: next,
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if err := e.removeTemp(); err != nil {
+		return nil, fmt.Errorf("diskbuffer: %w", err)
+	}
+	files, err := e.files()
+	if err != nil {
+		return nil, fmt.Errorf("diskbuffer: %w", err)
+	}
+	for _, f := range files {
+		e.buffered.Add(int64(f.spans))
+	}
+
+	if err := e.registerMetrics(); err != nil {
+		return nil, fmt.Errorf("diskbuffer: %w", err)
+	}
+
+	go e.replayLoop()
+
+	return e, nil
+}
+
+// ExportSpans отправляет пачку во вложенный экспортер, а при ошибке сохраняет
+// ее на диск. Ошибка возвращается, только если сохранить пачку не удалось.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.export(ctx, spans)
+	if err == nil {
+		// Коллектор доступен — самое время отправить накопленное
+		if e.buffered.Load() > 0 {
+			e.triggerReplay()
+		}
+		return nil
+	}
+
+	if spillErr := e.spill(spans); spillErr != nil {
+		e.dropped.Add(int64(len(spans)))
+		return fmt.Errorf("%w; diskbuffer: %v", err, spillErr)
+	}
+	return nil
+}
+
+func (e *Exporter) export(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.exportMu.Lock()
+	defer e.exportMu.Unlock()
+	return e.next.ExportSpans(ctx, spans)
+}
+
+// Shutdown останавливает повторную отправку и вложенный экспортер.
+// Пачки на диске сохраняются до следующего запуска.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+		if e.registration != nil {
+			if err := e.registration.Unregister(); err != nil {
+				log.Printf("diskbuffer: failed to unregister metrics: %v", err)
+			}
+		}
+	})
+	return e.next.Shutdown(ctx)
+}
+
+// Stats возвращает текущие значения счетчиков
+func (e *Exporter) Stats() Stats {
+	return Stats{
+		Buffered: e.buffered.Load(),
+		Dropped:  e.dropped.Load(),
+		Replayed: e.replayed.Load(),
+	}
+}
+
+func (e *Exporter) registerMetrics() error {
+	meter := e.cfg.MeterProvider.Meter("github.com/DifferentialOrange/go-tracing-example/diskbuffer")
+
+	buffered, err := meter.Int64ObservableUpDownCounter("diskbuffer.spans.buffered",
+		metric.WithDescription("Number of spans currently stored on disk."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return err
+	}
+	dropped, err := meter.Int64ObservableCounter("diskbuffer.spans.dropped",
+		metric.WithDescription("Number of spans dropped because of size limits or write errors."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return err
+	}
+	replayed, err := meter.Int64ObservableCounter("diskbuffer.spans.replayed",
+		metric.WithDescription("Number of spans successfully exported from disk."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	e.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := e.Stats()
+		o.ObserveInt64(buffered, stats.Buffered)
+		o.ObserveInt64(dropped, stats.Dropped)
+		o.ObserveInt64(replayed, stats.Replayed)
+		return nil
+	}, buffered, dropped, replayed)
+	return err
+}
+
+// batchFile — сохраненная пачка; время и число span закодированы в имени
+type batchFile struct {
+	path  string
+	size  int64
+	spans int
+}
+
+func (e *Exporter) fileName(spans int) string {
+	e.seq++
+	return fmt.Sprintf("%020d-%06d-%d.json", time.Now().UnixNano(), e.seq, spans)
+}
+
+// files возвращает сохраненные пачки от старых к новым
+func (e *Exporter) files() ([]batchFile, error) {
+	entries, err := os.ReadDir(e.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []batchFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(name, ".json"), "-")
+		if len(parts) != 3 {
+			continue
+		}
+		spans, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, batchFile{
+			path:  filepath.Join(e.cfg.Dir, name),
+			size:  info.Size(),
+			spans: spans,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	return files, nil
+}
+
+// removeTemp удаляет временные файлы, которые spill не успел переименовать
+// до остановки процесса: иначе они занимали бы место сверх MaxBytes
+func (e *Exporter) removeTemp() error {
+	entries, err := os.ReadDir(e.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		tmp := filepath.Join(e.cfg.Dir, entry.Name())
+		if err := os.Remove(tmp); err != nil {
+			return err
+		}
+		log.Printf("diskbuffer: removed incomplete batch %s", tmp)
+	}
+	return nil
+}
+
+// spill записывает пачку на диск, при необходимости освобождая место
+// удалением самых старых пачек
+func (e *Exporter) spill(spans []sdktrace.ReadOnlySpan) error {
+	data, err := encodeSpans(spans)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > e.cfg.MaxBytes {
+		return fmt.Errorf("batch of %d bytes exceeds buffer size %d", len(data), e.cfg.MaxBytes)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	files, err := e.files()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	for len(files) > 0 && total+int64(len(data)) > e.cfg.MaxBytes {
+		oldest := files[0]
+		files = files[1:]
+		if err := os.Remove(oldest.path); err != nil {
+			return err
+		}
+		total -= oldest.size
+		e.buffered.Add(-int64(oldest.spans))
+		e.dropped.Add(int64(oldest.spans))
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы replay не прочитал
+	// недописанную пачку
+	path := filepath.Join(e.cfg.Dir, e.fileName(len(spans)))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	e.buffered.Add(int64(len(spans)))
+
+	return nil
+}
+
+func (e *Exporter) triggerReplay() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Exporter) replayLoop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+		if e.buffered.Load() > 0 {
+			e.replay()
+		}
+	}
+}
+
+// replay отправляет пачки с диска по порядку до первой ошибки. Блокировка
+// не держится во время отправки, чтобы не задерживать новые пачки.
+func (e *Exporter) replay() {
+	e.mu.Lock()
+	files, err := e.files()
+	e.mu.Unlock()
+	if err != nil {
+		log.Printf("diskbuffer: failed to list buffered batches: %v", err)
+		return
+	}
+
+	for _, f := range files {
+		select {
+		case <-e.stop:
+			return
+		default:
+		}
+
+		data, err := os.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			// Пачку уже вытеснил spill
+			continue
+		}
+		if err != nil {
+			log.Printf("diskbuffer: failed to read %s: %v", f.path, err)
+			return
+		}
+		spans, err := decodeSpans(data)
+		if err != nil {
+			// Испорченный файл повторять бессмысленно
+			log.Printf("diskbuffer: dropping corrupted batch %s: %v", f.path, err)
+			if e.remove(f) {
+				e.dropped.Add(int64(f.spans))
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = e.export(ctx, spans)
+		cancel()
+		if err != nil {
+			return
+		}
+
+		// Пачку, которую spill вытеснил во время отправки, уже посчитали
+		// потерянной
+		if e.remove(f) {
+			e.replayed.Add(int64(f.spans))
+		}
+	}
+}
+
+// remove удаляет пачку и возвращает false, если ее уже удалил spill
+// (тогда span уже учтены как потерянные)
+func (e *Exporter) remove(f batchFile) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := os.Remove(f.path); err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("diskbuffer: failed to remove %s: %v", f.path, err)
+		}
+		return false
+	}
+	e.buffered.Add(-int64(f.spans))
+	return true
+}
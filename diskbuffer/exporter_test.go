@@ -0,0 +1,248 @@
+package diskbuffer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// flakyExporter отклоняет пачки, пока down выставлен в true
+type flakyExporter struct {
+	mu       sync.Mutex
+	down     bool
+	exported []sdktrace.ReadOnlySpan
+}
+
+func (f *flakyExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.down {
+		return errors.New("collector unreachable")
+	}
+	f.exported = append(f.exported, spans...)
+	return nil
+}
+
+func (f *flakyExporter) Shutdown(context.Context) error { return nil }
+
+func (f *flakyExporter) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flakyExporter) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.exported)
+}
+
+func recordSpans(t *testing.T, n int) []sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("diskbuffer-test")
+
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.WithSpanKind(trace.SpanKindServer))
+	for i := 0; i < n-1; i++ {
+		_, child := tracer.Start(ctx, "child", trace.WithAttributes(
+			attribute.Int("index", i),
+			attribute.StringSlice("tags", []string{"a", "b"}),
+		))
+		child.AddEvent("event", trace.WithAttributes(attribute.Bool("ok", true)))
+		child.SetStatus(codes.Error, "failed")
+		child.End()
+	}
+	parent.End()
+
+	return recorder.Ended()
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	spans := recordSpans(t, 3)
+
+	data, err := encodeSpans(spans)
+	if err != nil {
+		t.Fatalf("encodeSpans() error = %v", err)
+	}
+	decoded, err := decodeSpans(data)
+	if err != nil {
+		t.Fatalf("decodeSpans() error = %v", err)
+	}
+
+	if len(decoded) != len(spans) {
+		t.Fatalf("decoded %d spans, want %d", len(decoded), len(spans))
+	}
+	for i := range spans {
+		want, got := tracetest.SpanStubFromReadOnlySpan(spans[i]), tracetest.SpanStubFromReadOnlySpan(decoded[i])
+		if got.Name != want.Name || !got.SpanContext.Equal(want.SpanContext) || got.Parent.SpanID() != want.Parent.SpanID() {
+			t.Errorf("span %d identity mismatch: got %+v, want %+v", i, got, want)
+		}
+		if !got.StartTime.Equal(want.StartTime) || !got.EndTime.Equal(want.EndTime) {
+			t.Errorf("span %d times mismatch", i)
+		}
+		if got.Status != want.Status || got.SpanKind != want.SpanKind {
+			t.Errorf("span %d status/kind = %v/%v, want %v/%v", i, got.Status, got.SpanKind, want.Status, want.SpanKind)
+		}
+		if gotAttrs, wantAttrs := attribute.NewSet(got.Attributes...), attribute.NewSet(want.Attributes...); !gotAttrs.Equals(&wantAttrs) {
+			t.Errorf("span %d attributes = %v, want %v", i, got.Attributes, want.Attributes)
+		}
+		if len(got.Events) != len(want.Events) {
+			t.Errorf("span %d events = %v, want %v", i, got.Events, want.Events)
+		}
+		if !got.Resource.Equal(want.Resource) {
+			t.Errorf("span %d resource = %v, want %v", i, got.Resource, want.Resource)
+		}
+	}
+}
+
+func TestSpillAndReplay(t *testing.T) {
+	next := &flakyExporter{down: true}
+	e, err := New(next, Config{Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer e.Shutdown(context.Background())
+
+	if err := e.ExportSpans(context.Background(), recordSpans(t, 4)); err != nil {
+		t.Fatalf("ExportSpans() error = %v", err)
+	}
+	if got := e.Stats().Buffered; got != 4 {
+		t.Fatalf("Buffered = %d, want 4", got)
+	}
+
+	next.setDown(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for next.count() < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("spans were not replayed, stats: %+v", e.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := e.Stats(); stats != (Stats{Buffered: 0, Dropped: 0, Replayed: 4}) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSizeLimitDropsOldest(t *testing.T) {
+	spans := recordSpans(t, 2)
+	data, err := encodeSpans(spans)
+	if err != nil {
+		t.Fatalf("encodeSpans() error = %v", err)
+	}
+
+	// Места хватает только на одну пачку
+	next := &flakyExporter{down: true}
+	e, err := New(next, Config{Dir: t.TempDir(), MaxBytes: int64(len(data)) + 10, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer e.Shutdown(context.Background())
+
+	for i := 0; i < 3; i++ {
+		if err := e.ExportSpans(context.Background(), spans); err != nil {
+			t.Fatalf("ExportSpans() error = %v", err)
+		}
+	}
+
+	if stats := e.Stats(); stats.Buffered != 2 || stats.Dropped != 4 {
+		t.Errorf("Stats() = %+v, want 2 buffered and 4 dropped", stats)
+	}
+}
+
+// serialExporter проверяет, что ExportSpans не вызывается одновременно
+type serialExporter struct {
+	inFlight   atomic.Int32
+	concurrent atomic.Bool
+	exported   atomic.Int64
+}
+
+func (s *serialExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if s.inFlight.Add(1) > 1 {
+		s.concurrent.Store(true)
+	}
+	time.Sleep(time.Millisecond)
+	s.inFlight.Add(-1)
+	s.exported.Add(int64(len(spans)))
+	return nil
+}
+
+func (s *serialExporter) Shutdown(context.Context) error { return nil }
+
+func TestReplayDoesNotOverlapExports(t *testing.T) {
+	dir := t.TempDir()
+	spans := recordSpans(t, 1)
+
+	// Пачки с прошлого запуска отправляются одновременно с новыми
+	down, err := New(&flakyExporter{down: true}, Config{Dir: dir, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := down.ExportSpans(context.Background(), spans); err != nil {
+			t.Fatalf("ExportSpans() error = %v", err)
+		}
+	}
+	down.Shutdown(context.Background())
+
+	next := &serialExporter{}
+	e, err := New(next, Config{Dir: dir, RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer e.Shutdown(context.Background())
+	for i := 0; i < 20; i++ {
+		if err := e.ExportSpans(context.Background(), spans); err != nil {
+			t.Fatalf("ExportSpans() error = %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for next.exported.Load() < 40 {
+		if time.Now().After(deadline) {
+			t.Fatalf("exported %d spans, want 40; stats: %+v", next.exported.Load(), e.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if next.concurrent.Load() {
+		t.Error("ExportSpans was called concurrently")
+	}
+	if stats := e.Stats(); stats != (Stats{Replayed: 20}) {
+		t.Errorf("Stats() = %+v, want 20 replayed", stats)
+	}
+}
+
+func TestStartupRemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, "00000000000000000001-000001-3.json.tmp")
+	if err := os.WriteFile(tmp, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(&flakyExporter{}, Config{Dir: dir, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer e.Shutdown(context.Background())
+
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temporary file survived startup: %v", err)
+	}
+	if stats := e.Stats(); stats.Buffered != 0 {
+		t.Errorf("Buffered = %d, want 0", stats.Buffered)
+	}
+}
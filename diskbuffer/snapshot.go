@@ -0,0 +1,62 @@
+package diskbuffer
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanSnapshot — span, прочитанный с диска. ReadOnlySpan содержит
+// неэкспортируемый метод, поэтому интерфейс встроен (и равен nil): все
+// остальные методы отдают сохраненные поля.
+type spanSnapshot struct {
+	sdktrace.ReadOnlySpan
+
+	name              string
+	spanContext       trace.SpanContext
+	parent            trace.SpanContext
+	kind              trace.SpanKind
+	startTime         time.Time
+	endTime           time.Time
+	attributes        []attribute.KeyValue
+	links             []sdktrace.Link
+	events            []sdktrace.Event
+	status            sdktrace.Status
+	scope             instrumentation.Scope
+	resource          *resource.Resource
+	droppedAttributes int
+	droppedLinks      int
+	droppedEvents     int
+	childSpanCount    int
+}
+
+func (s *spanSnapshot) Name() string                                { return s.name }
+func (s *spanSnapshot) SpanContext() trace.SpanContext              { return s.spanContext }
+func (s *spanSnapshot) Parent() trace.SpanContext                   { return s.parent }
+func (s *spanSnapshot) SpanKind() trace.SpanKind                    { return s.kind }
+func (s *spanSnapshot) StartTime() time.Time                        { return s.startTime }
+func (s *spanSnapshot) EndTime() time.Time                          { return s.endTime }
+func (s *spanSnapshot) Attributes() []attribute.KeyValue            { return s.attributes }
+func (s *spanSnapshot) Links() []sdktrace.Link                      { return s.links }
+func (s *spanSnapshot) Events() []sdktrace.Event                    { return s.events }
+func (s *spanSnapshot) Status() sdktrace.Status                     { return s.status }
+func (s *spanSnapshot) InstrumentationScope() instrumentation.Scope { return s.scope }
+func (s *spanSnapshot) Resource() *resource.Resource                { return s.resource }
+func (s *spanSnapshot) DroppedAttributes() int                      { return s.droppedAttributes }
+func (s *spanSnapshot) DroppedLinks() int                           { return s.droppedLinks }
+func (s *spanSnapshot) DroppedEvents() int                          { return s.droppedEvents }
+func (s *spanSnapshot) ChildSpanCount() int                         { return s.childSpanCount }
+
+// InstrumentationLibrary устарел, но входит в интерфейс ReadOnlySpan
+func (s *spanSnapshot) InstrumentationLibrary() instrumentation.Library {
+	return instrumentation.Library{
+		Name:       s.scope.Name,
+		Version:    s.scope.Version,
+		SchemaURL:  s.scope.SchemaURL,
+		Attributes: s.scope.Attributes,
+	}
+}
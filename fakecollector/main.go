@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/DifferentialOrange/go-tracing-example/otlpfake"
+)
+
+func main() {
+	httpAddr := flag.String("http-addr", ":4318", "OTLP/HTTP listen address")
+	grpcAddr := flag.String("grpc-addr", ":4317", "OTLP/gRPC listen address")
+	flag.Parse()
+
+	// Пачки приходят из разных горутин, не даем выводу перемешаться
+	var mu sync.Mutex
+	collector, err := otlpfake.Start(
+		otlpfake.WithHTTPAddr(*httpAddr),
+		otlpfake.WithGRPCAddr(*grpcAddr),
+		otlpfake.WithOnSpans(func(spans []otlpfake.Span) {
+			mu.Lock()
+			defer mu.Unlock()
+			otlpfake.Print(os.Stdout, spans)
+		}),
+	)
+	if err != nil {
+		log.Fatalf("failed to start collector: %v", err)
+	}
+
+	log.Printf("Fake collector started: OTLP/HTTP on %s, OTLP/gRPC on %s",
+		collector.HTTPEndpoint(), collector.GRPCAddr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	if err := collector.Shutdown(context.Background()); err != nil {
+		log.Printf("Error shutting down collector: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package grpctrace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BinaryHeader — заголовок, в котором старые gRPC и OpenCensus сервисы
+// передают контекст трассировки
+const BinaryHeader = "grpc-trace-bin"
+
+// Формат OpenCensus: версия, затем поля с номерами
+// 0 — trace id (16 байт), 1 — span id (8 байт), 2 — флаги (1 байт)
+const (
+	binaryVersion      = 0
+	binaryTraceIDField = 0
+	binarySpanIDField  = 1
+	binaryOptionsField = 2
+	binaryLen          = 1 + 1 + 16 + 1 + 8 + 1 + 1
+)
+
+// BinaryPropagator переносит контекст трассировки в бинарном заголовке
+// grpc-trace-bin. gRPC сам кодирует значения заголовков с суффиксом -bin в
+// base64, поэтому с MetadataCarrier значение — это просто байты в строке.
+type BinaryPropagator struct{}
+
+var _ propagation.TextMapPropagator = BinaryPropagator{}
+
+// Inject записывает контекст span из ctx в grpc-trace-bin
+func (BinaryPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set(BinaryHeader, string(EncodeBinary(sc)))
+}
+
+// Extract достает удаленный контекст span из grpc-trace-bin
+func (BinaryPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	value := carrier.Get(BinaryHeader)
+	if value == "" {
+		return ctx
+	}
+	sc, err := DecodeBinary([]byte(value))
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields возвращает заголовки, которые пишет propagator
+func (BinaryPropagator) Fields() []string {
+	return []string{BinaryHeader}
+}
+
+// EncodeBinary кодирует контекст span в формат grpc-trace-bin
+func EncodeBinary(sc trace.SpanContext) []byte {
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+
+	b := make([]byte, 0, binaryLen)
+	b = append(b, binaryVersion)
+	b = append(b, binaryTraceIDField)
+	b = append(b, traceID[:]...)
+	b = append(b, binarySpanIDField)
+	b = append(b, spanID[:]...)
+	b = append(b, binaryOptionsField, byte(sc.TraceFlags()&trace.FlagsSampled))
+	return b
+}
+
+// DecodeBinary разбирает grpc-trace-bin. Поля идут по возрастанию номеров,
+// неизвестные поля в конце пропускаются, как того требует формат.
+func DecodeBinary(b []byte) (trace.SpanContext, error) {
+	if len(b) == 0 || b[0] != binaryVersion {
+		return trace.SpanContext{}, fmt.Errorf("grpc-trace-bin: unsupported version")
+	}
+	b = b[1:]
+
+	var cfg trace.SpanContextConfig
+	for len(b) > 0 {
+		field := b[0]
+		b = b[1:]
+		switch field {
+		case binaryTraceIDField:
+			if len(b) < 16 {
+				return trace.SpanContext{}, fmt.Errorf("grpc-trace-bin: short trace id")
+			}
+			copy(cfg.TraceID[:], b[:16])
+			b = b[16:]
+		case binarySpanIDField:
+			if len(b) < 8 {
+				return trace.SpanContext{}, fmt.Errorf("grpc-trace-bin: short span id")
+			}
+			copy(cfg.SpanID[:], b[:8])
+			b = b[8:]
+		case binaryOptionsField:
+			if len(b) < 1 {
+				return trace.SpanContext{}, fmt.Errorf("grpc-trace-bin: short trace options")
+			}
+			cfg.TraceFlags = trace.TraceFlags(b[0]) & trace.FlagsSampled
+			b = b[1:]
+		default:
+			// Новые поля могут появиться только после известных
+			b = nil
+		}
+	}
+
+	cfg.Remote = true
+	sc := trace.NewSpanContext(cfg)
+	if !sc.IsValid() {
+		return trace.SpanContext{}, fmt.Errorf("grpc-trace-bin: invalid span context")
+	}
+	return sc, nil
+}
+
+// ParsePropagators собирает propagator из списка имен через запятую, как в
+// OTEL_PROPAGATORS: tracecontext, baggage и grpc-trace-bin. При внедрении
+// пишутся все заголовки. Если клиент прислал и traceparent, и grpc-trace-bin,
+// побеждает тот, что указан в списке раньше.
+func ParsePropagators(list string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range strings.Split(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case BinaryHeader:
+			propagators = append(propagators, BinaryPropagator{})
+		case "", "none":
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+
+	// Составной propagator применяет Extract по порядку, и каждый следующий
+	// найденный контекст span заменяет предыдущий, поэтому разворачиваем список
+	for i, j := 0, len(propagators)-1; i < j; i, j = i+1, j-1 {
+		propagators[i], propagators[j] = propagators[j], propagators[i]
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
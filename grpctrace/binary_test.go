@@ -0,0 +1,122 @@
+package grpctrace_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func mustSpanContext(t *testing.T, traceID, spanID string, flags trace.TraceFlags) trace.SpanContext {
+	t.Helper()
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: flags, Remote: true})
+}
+
+func TestBinaryEncoding(t *testing.T) {
+	sc := mustSpanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", trace.FlagsSampled)
+
+	// Пример из спецификации формата OpenCensus
+	want := []byte{
+		0,
+		0, 0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36,
+		1, 0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7,
+		2, 1,
+	}
+	if got := grpctrace.EncodeBinary(sc); !bytes.Equal(got, want) {
+		t.Errorf("EncodeBinary() = %x, want %x", got, want)
+	}
+
+	got, err := grpctrace.DecodeBinary(append(want, 3, 0xff))
+	if err != nil {
+		t.Fatalf("DecodeBinary() error = %v", err)
+	}
+	if !got.Equal(sc) {
+		t.Errorf("DecodeBinary() = %v, want %v", got, sc)
+	}
+
+	for _, invalid := range [][]byte{nil, {1}, want[:10], {0, 1, 1, 2, 3, 4, 5, 6, 7, 8}} {
+		if _, err := grpctrace.DecodeBinary(invalid); err == nil {
+			t.Errorf("DecodeBinary(%x) returned no error", invalid)
+		}
+	}
+}
+
+func TestPropagatorPrecedence(t *testing.T) {
+	w3c := mustSpanContext(t, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", trace.FlagsSampled)
+	binary := mustSpanContext(t, "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331", 0)
+
+	md := metadata.Pairs(
+		"traceparent", "00-"+w3c.TraceID().String()+"-"+w3c.SpanID().String()+"-01",
+		grpctrace.BinaryHeader, string(grpctrace.EncodeBinary(binary)),
+	)
+
+	tests := []struct {
+		propagators string
+		want        trace.SpanContext
+	}{
+		{propagators: "tracecontext,grpc-trace-bin", want: w3c},
+		{propagators: "grpc-trace-bin,tracecontext,baggage", want: binary},
+		{propagators: "grpc-trace-bin", want: binary},
+		{propagators: "tracecontext", want: w3c},
+	}
+	for _, tt := range tests {
+		propagator, err := grpctrace.ParsePropagators(tt.propagators)
+		if err != nil {
+			t.Fatalf("ParsePropagators(%q) error = %v", tt.propagators, err)
+		}
+		ctx := propagator.Extract(context.Background(), grpctrace.MetadataCarrier(md))
+		if got := trace.SpanContextFromContext(ctx); !got.Equal(tt.want) {
+			t.Errorf("%s: extracted %s, want %s", tt.propagators, got.TraceID(), tt.want.TraceID())
+		}
+	}
+
+	// Когда заголовок один, порядок не важен
+	only := metadata.Pairs(grpctrace.BinaryHeader, string(grpctrace.EncodeBinary(binary)))
+	propagator, _ := grpctrace.ParsePropagators("tracecontext,grpc-trace-bin")
+	ctx := propagator.Extract(context.Background(), grpctrace.MetadataCarrier(only))
+	if got := trace.SpanContextFromContext(ctx); !got.Equal(binary) {
+		t.Errorf("extracted %s from grpc-trace-bin only, want %s", got.TraceID(), binary.TraceID())
+	}
+
+	if _, err := grpctrace.ParsePropagators("tracecontext,b3"); err == nil {
+		t.Error("ParsePropagators() with unknown propagator returned no error")
+	}
+}
+
+func TestBinaryPropagation(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Обе стороны говорят только на grpc-trace-bin, как старые сервисы
+	propagator, err := grpctrace.ParsePropagators(grpctrace.BinaryHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	if _, err := env.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+		t.Fatalf("SayHello() error = %v", err)
+	}
+
+	spans := env.waitForSpans(t, 3)
+	client := spans[trace.SpanKindClient.String()]
+	server := spans[trace.SpanKindServer.String()]
+	if server.Parent().SpanID() != client.SpanContext().SpanID() || !server.Parent().IsRemote() {
+		t.Errorf("server span parent = %v, want remote %s", server.Parent(), client.SpanContext().SpanID())
+	}
+	if server.SpanContext().TraceID() != client.SpanContext().TraceID() {
+		t.Errorf("server trace id = %s, want %s", server.SpanContext().TraceID(), client.SpanContext().TraceID())
+	}
+}
@@ -0,0 +1,63 @@
+// Package grpctrace содержит общую для клиента и сервера инструментацию
+// gRPC: interceptors, которые создают span и пишут метрики, и перенос
+// контекста трассировки через метаданные.
+package grpctrace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc/metadata"
+)
+
+// InjectSpanContext добавляет контекст трассировки из ctx в исходящие метаданные
+func InjectSpanContext(ctx context.Context) context.Context {
+	// Создаем carrier для передачи контекста, сохраняя уже заданные метаданные
+	md, _ := metadata.FromOutgoingContext(ctx)
+	carrier := MetadataCarrier(md.Copy())
+	propagator := otel.GetTextMapPropagator()
+	propagator.Inject(ctx, carrier)
+
+	// Флаг отладки идет и отдельным заголовком для сервисов без baggage
+	if token, ok := DebugFromContext(ctx); ok {
+		carrier.Set(DebugHeader, token)
+	}
+
+	return metadata.NewOutgoingContext(ctx, metadata.MD(carrier))
+}
+
+// ExtractSpanContext достает удаленный контекст трассировки из входящих метаданных
+func ExtractSpanContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	// Извлекаем trace context из метаданных
+	carrier := MetadataCarrier(md)
+	propagator := otel.GetTextMapPropagator()
+	return propagator.Extract(ctx, carrier)
+}
+
+// MetadataCarrier адаптирует gRPC метаданные к propagation.TextMapCarrier
+type MetadataCarrier metadata.MD
+
+func (m MetadataCarrier) Get(key string) string {
+	values := m[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (m MetadataCarrier) Set(key, value string) {
+	m[key] = []string{value}
+}
+
+func (m MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,97 @@
+package grpctrace
+
+import (
+	"context"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor создает span для каждого исходящего вызова, передает
+// контекст трассировки серверу и пишет задержку в metrics. Политики (см.
+// WithPolicies) применяются так же, как в UnaryServerInterceptor.
+func UnaryClientInterceptor(tracer trace.Tracer, metrics *Metrics, opts ...Option) grpc.UnaryClientInterceptor {
+	cfg := newConfig(opts)
+
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		policy := cfg.policies.Lookup(method)
+		if policy.Disabled {
+			return invoker(InjectSpanContext(ctx), method, req, reply, cc, opts...)
+		}
+
+		// Создаем span для gRPC вызова; семантические атрибуты передаем сразу,
+		// чтобы семплер мог выбрать правило по rpc.method
+		ctx, span := tracer.Start(ctx, policy.spanName(method),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithTimestamp(cfg.clock.Now()),
+			trace.WithAttributes(rpcAttributes(method)...),
+			trace.WithAttributes(attribute.String("net.peer.name", cc.Target())),
+		)
+		defer func() { span.End(trace.WithTimestamp(cfg.clock.Now())) }()
+
+		span.SetAttributes(policy.requestAttributes(req, cfg.redact)...)
+		span.SetAttributes(annotatedAttributes(req)...)
+		cfg.payload.addPayloadEvent(span, "SENT", req, cfg.clock.Now())
+
+		// Передаем арендатора отдельным заголовком для сервисов без baggage
+		if tenantID := tenant.FromContext(ctx); tenantID != "" {
+			span.SetAttributes(tenant.AttributeKey.String(tenantID))
+			ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, tenantID)
+		}
+
+		// Внедряем контекст трассировки в исходящие метаданные
+		ctx = InjectSpanContext(ctx)
+
+		// Выполняем вызов; peer покажет адрес, который выбрал балансировщик
+		var p peer.Peer
+		start := cfg.clock.Now()
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		if p.Addr != nil {
+			span.SetAttributes(attribute.String("net.sock.peer.addr", p.Addr.String()))
+		}
+
+		// Записываем задержку; exemplar свяжет бакет с текущим trace
+		metrics.record(ctx, cfg.clock.Now().Sub(start),
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+			attribute.Int("rpc.grpc.status_code", int(status.Code(err))),
+		)
+
+		// Обрабатываем результат
+		cfg.setClientStatus(span, policy, err)
+		if err == nil {
+			span.SetAttributes(policy.responseAttributes(reply, cfg.redact)...)
+			span.SetAttributes(annotatedAttributes(reply)...)
+			cfg.payload.addPayloadEvent(span, "RECEIVED", reply, cfg.clock.Now())
+		}
+
+		return err
+	}
+}
+
+// setClientStatus записывает в клиентский span статус по политике метода.
+// Общий для interceptor и оберток.
+func (c *config) setClientStatus(span trace.Span, policy MethodPolicy, err error) {
+	if err == nil {
+		span.SetStatus(codes.Ok, "success")
+		return
+	}
+	if policy.isError(status.Code(err)) {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err, trace.WithTimestamp(c.clock.Now()))
+		span.SetAttributes(attribute.Bool("error", true))
+	}
+}
@@ -0,0 +1,144 @@
+package grpctrace
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/netip"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// DebugHeader включает семплирование всего trace независимо от доли
+	DebugHeader = "x-debug-trace"
+	// DebugBaggageKey — отметка об отладке в baggage, для обработчиков и
+	// сервисов, которые передают дальше только baggage. Токен в baggage не
+	// попадает: baggage уходит во все сервисы по цепочке.
+	DebugBaggageKey = "debug.trace"
+
+	// debugMarker заменяет проверенный токен: дальше по цепочке и в baggage,
+	// который видят обработчики, уходит только факт отладки, а не секрет
+	debugMarker = "1"
+)
+
+type debugKey struct{}
+
+// ContextWithDebug помечает контекст флагом отладки со значением token:
+// span в нем семплируются (см. DebugSampler), а исходящие вызовы передают
+// флаг в заголовке DebugHeader только следующему сервису
+func ContextWithDebug(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, debugKey{}, token)
+}
+
+// contextWithDebugMarker помечает контекст принятым флагом отладки: токен
+// заменяется на debugMarker и в контексте, и в baggage
+func contextWithDebugMarker(ctx context.Context) context.Context {
+	if member, err := baggage.NewMember(DebugBaggageKey, debugMarker); err == nil {
+		if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
+	}
+	return ContextWithDebug(ctx, debugMarker)
+}
+
+// DebugFromContext возвращает значение флага отладки, если он установлен
+func DebugFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(debugKey{}).(string)
+	return token, ok
+}
+
+// DebugSampler семплирует span с флагом отладки в родительском контексте,
+// а решение по остальным span оставляет fallback
+func DebugSampler(fallback sdktrace.Sampler) sdktrace.Sampler {
+	return debugSampler{fallback: fallback}
+}
+
+type debugSampler struct {
+	fallback sdktrace.Sampler
+}
+
+func (s debugSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if _, ok := DebugFromContext(p.ParentContext); !ok {
+		return s.fallback.ShouldSample(p)
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{attribute.Bool("debug.trace", true)},
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s debugSampler) Description() string {
+	return "DebugSampler{fallback=" + s.fallback.Description() + "}"
+}
+
+// DebugPolicy решает, каким входящим флагам отладки верить: иначе любой
+// клиент мог бы заставить сервер записывать все свои запросы. Флаг
+// принимается, если его значение есть в Tokens, или с любым значением
+// (например "1") от клиента из AllowedNetworks или AllowedIdentities.
+// Отметку "1", которую передает дальше сервис, проверивший токен, сервер
+// принимает и от клиентов, доверенных по TrustPolicy (см. WithTrustPolicy),
+// поэтому токен нужен только первому сервису в цепочке.
+type DebugPolicy struct {
+	Tokens []string
+	// AllowedNetworks и AllowedIdentities проверяются так же, как
+	// TrustedNetworks и TrustedIdentities в TrustPolicy
+	AllowedNetworks   []netip.Prefix
+	AllowedIdentities []string
+}
+
+// WithDebugPolicy включает флаг отладки во входящих вызовах. Без этой опции
+// сервер флаг не принимает.
+func WithDebugPolicy(policy DebugPolicy) Option {
+	return func(c *config) { c.debug = &policy }
+}
+
+// extract переносит проверенный флаг отладки из заголовка или baggage в
+// контекст, заменяя токен на debugMarker. Отметке debugMarker верит, только
+// если trust задана и доверяет клиенту. Отклоненный флаг убирается из
+// baggage, чтобы не уйти дальше.
+func (p *DebugPolicy) extract(ctx context.Context, trust *TrustPolicy) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get(DebugHeader); len(values) > 0 {
+		token = values[0]
+	}
+	bag := baggage.FromContext(ctx)
+	if token == "" {
+		token = bag.Member(DebugBaggageKey).Value()
+	}
+	if token == "" {
+		return ctx
+	}
+
+	if p != nil && (p.allowed(ctx, token) || token == debugMarker && trust != nil && trust.trusted(ctx)) {
+		return contextWithDebugMarker(ctx)
+	}
+
+	slog.Debug("Debug trace flag rejected", "header", DebugHeader)
+	return baggage.ContextWithBaggage(ctx, bag.DeleteMember(DebugBaggageKey))
+}
+
+func (p *DebugPolicy) allowed(ctx context.Context, token string) bool {
+	for _, t := range p.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	peers := TrustPolicy{TrustedIdentities: p.AllowedIdentities, TrustedNetworks: p.AllowedNetworks}
+	return peers.trustedIdentity(pr.AuthInfo) || peers.trustedAddr(pr.Addr)
+}
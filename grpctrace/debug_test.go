@@ -0,0 +1,204 @@
+package grpctrace_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestDebugFlag(t *testing.T) {
+	policy := grpctrace.WithDebugPolicy(grpctrace.DebugPolicy{Tokens: []string{"secret"}})
+
+	tests := []struct {
+		name string
+		opts []grpctrace.Option
+		// ctx готовит контекст клиента
+		ctx func() context.Context
+		// spans — ожидаемые записанные span по виду или имени
+		spans []string
+	}{
+		{
+			name:  "client flag with valid token",
+			opts:  []grpctrace.Option{policy},
+			ctx:   func() context.Context { return grpctrace.ContextWithDebug(context.Background(), "secret") },
+			spans: []string{"client", "server", "SayHello"},
+		},
+		{
+			// Клиент свой флаг не проверяет, сервер его отклоняет
+			name:  "client flag with wrong token",
+			opts:  []grpctrace.Option{policy},
+			ctx:   func() context.Context { return grpctrace.ContextWithDebug(context.Background(), "guess") },
+			spans: []string{"client"},
+		},
+		{
+			name: "header only",
+			opts: []grpctrace.Option{policy},
+			ctx: func() context.Context {
+				return metadata.AppendToOutgoingContext(context.Background(), grpctrace.DebugHeader, "secret")
+			},
+			spans: []string{"server", "SayHello"},
+		},
+		{
+			name:  "server without policy",
+			ctx:   func() context.Context { return grpctrace.ContextWithDebug(context.Background(), "secret") },
+			spans: []string{"client"},
+		},
+		{
+			name:  "no flag",
+			opts:  []grpctrace.Option{policy},
+			ctx:   context.Background,
+			spans: nil,
+		},
+	}
+
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		for _, tt := range tests {
+			t.Run(mode.String()+"/"+tt.name, func(t *testing.T) {
+				env := startSampledTestEnv(t, mode, grpctrace.DebugSampler(sdktrace.NeverSample()), tt.opts...)
+
+				if _, err := env.client.SayHello(tt.ctx(), &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+					t.Fatalf("SayHello() error = %v", err)
+				}
+
+				// Серверные span заканчиваются после ответа клиенту; лишние span
+				// могли бы закончиться позже ожидаемых
+				if len(tt.spans) > 0 {
+					env.waitForSpans(t, len(tt.spans))
+				}
+				time.Sleep(50 * time.Millisecond)
+				got := make(map[string]sdktrace.ReadOnlySpan)
+				for _, s := range env.recorder.Ended() {
+					switch s.SpanKind() {
+					case trace.SpanKindClient:
+						got["client"] = s
+					case trace.SpanKindServer:
+						got["server"] = s
+					default:
+						got[s.Name()] = s
+					}
+				}
+				if len(got) != len(tt.spans) {
+					t.Fatalf("recorded spans = %v, want %v", keys(got), tt.spans)
+				}
+				for _, name := range tt.spans {
+					s, ok := got[name]
+					if !ok {
+						t.Fatalf("recorded spans = %v, want %v", keys(got), tt.spans)
+					}
+					if !hasAttribute(s, "debug.trace") {
+						t.Errorf("%s span has no debug.trace attribute", name)
+					}
+				}
+
+				// Дальше сервера идет только отметка об отладке, а не токен
+				if handler, ok := got["SayHello"]; ok {
+					var bag string
+					for _, kv := range handler.Attributes() {
+						if kv.Key == "test.baggage" {
+							bag = kv.Value.AsString()
+						}
+					}
+					if bag != "debug.trace=1" {
+						t.Errorf("handler baggage = %q, want debug.trace=1", bag)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestDebugFlagChain проверяет цепочку из трех сервисов: первый проверяет
+// токен, второй получает от него только отметку "1" и принимает ее, если
+// доверяет первому
+func TestDebugFlagChain(t *testing.T) {
+	debug := grpctrace.WithDebugPolicy(grpctrace.DebugPolicy{Tokens: []string{"secret"}})
+	trust := grpctrace.WithTrustPolicy(grpctrace.TrustPolicy{RequireAuth: true})
+
+	tests := []struct {
+		name string
+		// opts — опции последнего сервера
+		opts []grpctrace.Option
+		// auth — передает ли средний сервис заголовок authorization
+		auth bool
+		// sampled — записан ли span последнего сервера
+		sampled bool
+	}{
+		{name: "trusted hop", opts: []grpctrace.Option{debug, trust}, auth: true, sampled: true},
+		{name: "untrusted hop", opts: []grpctrace.Option{debug, trust}},
+		{name: "no trust policy", opts: []grpctrace.Option{debug}, auth: true},
+	}
+
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		for _, tt := range tests {
+			t.Run(mode.String()+"/"+tt.name, func(t *testing.T) {
+				sampler := grpctrace.DebugSampler(sdktrace.NeverSample())
+				last := startSampledTestEnv(t, mode, sampler, tt.opts...)
+				var header, bag string
+				last.greeter.onCall = func(ctx context.Context) {
+					md, _ := metadata.FromIncomingContext(ctx)
+					header = strings.Join(md.Get(grpctrace.DebugHeader), ",")
+					bag = strings.Join(md.Get("baggage"), ",")
+				}
+
+				first := startSampledTestEnv(t, mode, sampler, debug)
+				first.greeter.onCall = func(ctx context.Context) {
+					if tt.auth {
+						ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer internal")
+					}
+					if _, err := last.client.SayHello(ctx, &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+						t.Errorf("downstream SayHello() error = %v", err)
+					}
+				}
+
+				ctx := grpctrace.ContextWithDebug(context.Background(), "secret")
+				if _, err := first.client.SayHello(ctx, &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+					t.Fatalf("SayHello() error = %v", err)
+				}
+
+				// Токен не уходит дальше первого сервиса ни в заголовке, ни в baggage
+				if header != "1" {
+					t.Errorf("downstream %s = %q, want 1", grpctrace.DebugHeader, header)
+				}
+				if strings.Contains(bag, "secret") {
+					t.Errorf("downstream baggage = %q contains the token", bag)
+				}
+
+				// Клиентский span среднего сервиса записывается всегда, серверные
+				// span последнего — только если он принял отметку
+				want := 1
+				if tt.sampled {
+					want = 3
+				}
+				last.waitForSpans(t, want)
+				time.Sleep(50 * time.Millisecond)
+				if got := len(last.recorder.Ended()); got != want {
+					t.Errorf("last service recorded %d spans, want %d", got, want)
+				}
+			})
+		}
+	}
+}
+
+func keys(m map[string]sdktrace.ReadOnlySpan) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func hasAttribute(s sdktrace.ReadOnlySpan, key string) bool {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return true
+		}
+	}
+	return false
+}
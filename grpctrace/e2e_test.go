@@ -0,0 +1,429 @@
+package grpctrace_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"github.com/DifferentialOrange/go-tracing-example/otlpfake"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	sayHelloMethod = "/hello.Greeter/SayHello"
+	testTarget     = "passthrough:///bufnet"
+)
+
+// greeter ведет себя в зависимости от имени в запросе: "error" возвращает
+// NotFound, "block" ждет отмены контекста, остальные отвечают сразу
+type greeter struct {
+	pb.UnimplementedGreeterServer
+	tracer  trace.Tracer
+	started chan struct{}
+	// onCall, если задан, получает контекст вызова до span обработчика
+	onCall func(ctx context.Context)
+}
+
+func (g *greeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if g.onCall != nil {
+		g.onCall(ctx)
+	}
+	ctx, span := g.tracer.Start(ctx, "SayHello")
+	defer span.End()
+
+	// Baggage, дошедший до обработчика, проверяют тесты политики доверия
+	if bag := baggage.FromContext(ctx); bag.Len() > 0 {
+		span.SetAttributes(attribute.String("test.baggage", bag.String()))
+	}
+
+	switch req.Name {
+	case "error":
+		return nil, status.Error(codes.NotFound, "no such greeting")
+	case "block":
+		close(g.started)
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	return &pb.HelloResponse{Message: "Hello, " + req.Name}, nil
+}
+
+type testEnv struct {
+	recorder *tracetest.SpanRecorder
+	// collector задан, если span уходят по OTLP, а не в recorder
+	collector *otlpfake.Collector
+	client    pb.GreeterClient
+	greeter   *greeter
+}
+
+// instrumentation — способ трассировки вызовов в тестовом окружении
+type instrumentation int
+
+const (
+	interceptors instrumentation = iota
+	// wrappers — обертки, сгенерированные protoc-gen-go-traced
+	wrappers
+	statsHandlers
+)
+
+func (i instrumentation) String() string {
+	return [...]string{"interceptors", "wrappers", "stats handlers"}[i]
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return startTestEnv(t, interceptors)
+}
+
+// startTestEnv поднимает сервер и клиент на bufconn, трассировку делает
+// mode; serverOpts передаются серверной инструментации.
+func startTestEnv(t *testing.T, mode instrumentation, serverOpts ...grpctrace.Option) *testEnv {
+	t.Helper()
+	return startSampledTestEnv(t, mode, sdktrace.ParentBased(sdktrace.AlwaysSample()), serverOpts...)
+}
+
+// startSampledTestEnv — startTestEnv с заданным семплером для клиента и сервера
+func startSampledTestEnv(t *testing.T, mode instrumentation, sampler sdktrace.Sampler, serverOpts ...grpctrace.Option) *testEnv {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler), sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	env := serveTestEnv(t, mode, tp.Tracer("grpctrace-test"), serverOpts...)
+	env.recorder = recorder
+	return env
+}
+
+// startExportedTestEnv — startTestEnv, который отправляет span по OTLP/HTTP
+// в поддельный коллектор, как это делают server и client
+func startExportedTestEnv(t *testing.T, mode instrumentation) *testEnv {
+	t.Helper()
+
+	collector, err := otlpfake.Start()
+	if err != nil {
+		t.Fatalf("failed to start collector: %v", err)
+	}
+	t.Cleanup(func() { _ = collector.Shutdown(context.Background()) })
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(collector.HTTPEndpoint()))
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(10*time.Millisecond)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "grpctrace-test"))),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	env := serveTestEnv(t, mode, tp.Tracer("grpctrace-test"))
+	env.collector = collector
+	return env
+}
+
+// serveTestEnv поднимает сервер и клиент на bufconn с трассировкой через tracer
+func serveTestEnv(t *testing.T, mode instrumentation, tracer trace.Tracer, serverOpts ...grpctrace.Option) *testEnv {
+	t.Helper()
+
+	// Interceptors берут propagator из глобального состояния
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	var grpcServerOpts []grpc.ServerOption
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	switch mode {
+	case interceptors:
+		grpcServerOpts = append(grpcServerOpts, grpc.UnaryInterceptor(grpctrace.UnaryServerInterceptor(tracer, nil, serverOpts...)))
+		dialOpts = append(dialOpts, grpc.WithUnaryInterceptor(grpctrace.UnaryClientInterceptor(tracer, nil)))
+	case statsHandlers:
+		grpcServerOpts = append(grpcServerOpts,
+			grpc.StatsHandler(grpctrace.NewServerHandler(tracer, nil, serverOpts...)),
+			grpc.UnaryInterceptor(grpctrace.StatsServerInterceptor()),
+		)
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(grpctrace.NewClientHandler(tracer, nil, grpctrace.WithPeerName(testTarget))))
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpcServerOpts...)
+	g := &greeter{tracer: tracer, started: make(chan struct{})}
+	if mode == wrappers {
+		pb.RegisterGreeterServer(srv, pb.NewTracedGreeterServer(g, tracer, serverOpts...))
+	} else {
+		pb.RegisterGreeterServer(srv, g)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	conn, err := grpc.NewClient(testTarget, dialOpts...)
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	client := pb.NewGreeterClient(conn)
+	if mode == wrappers {
+		client = pb.NewTracedGreeterClient(client, tracer)
+	}
+
+	return &testEnv{
+		client:  client,
+		greeter: g,
+	}
+}
+
+// waitForSpans ждет завершения n span: серверный span может закончиться
+// позже, чем клиент получит ответ
+func (e *testEnv) waitForSpans(t *testing.T, n int) map[string]sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ended := e.recorder.Ended()
+		if len(ended) >= n {
+			byKind := make(map[string]sdktrace.ReadOnlySpan)
+			for _, s := range ended {
+				key := s.SpanKind().String()
+				if s.SpanKind() == trace.SpanKindInternal {
+					key = s.Name()
+				}
+				byKind[key] = s
+			}
+			return byKind
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d ended spans, got %d", n, len(ended))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func attrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestUnaryCall(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    string
+		timeout    time.Duration
+		cancel     bool
+		wantCode   codes.Code
+		wantStatus otelcodes.Code
+	}{
+		{name: "success", request: "Go Developer", wantCode: codes.OK, wantStatus: otelcodes.Ok},
+		{name: "error", request: "error", wantCode: codes.NotFound, wantStatus: otelcodes.Error},
+		{name: "deadline exceeded", request: "block", timeout: 50 * time.Millisecond, wantCode: codes.DeadlineExceeded, wantStatus: otelcodes.Error},
+		{name: "cancelled", request: "block", cancel: true, wantCode: codes.Canceled, wantStatus: otelcodes.Error},
+	}
+
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		for _, tt := range tests {
+			t.Run(mode.String()+"/"+tt.name, func(t *testing.T) {
+				env := startTestEnv(t, mode)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				if tt.timeout > 0 {
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				}
+				if tt.cancel {
+					go func() {
+						<-env.greeter.started
+						cancel()
+					}()
+				}
+
+				var header, trailer metadata.MD
+				_, err := env.client.SayHello(ctx, &pb.HelloRequest{Name: tt.request},
+					grpc.Header(&header),
+					grpc.Trailer(&trailer),
+				)
+				if got := status.Code(err); got != tt.wantCode {
+					t.Fatalf("SayHello() code = %v, want %v (err: %v)", got, tt.wantCode, err)
+				}
+
+				spans := env.waitForSpans(t, 3)
+				client := spans[trace.SpanKindClient.String()]
+				server := spans[trace.SpanKindServer.String()]
+				handler := spans["SayHello"]
+				if client == nil || server == nil || handler == nil {
+					t.Fatalf("expected client, server and handler spans, got %v", spans)
+				}
+
+				// Имена и типы span
+				if client.Name() != sayHelloMethod || server.Name() != sayHelloMethod {
+					t.Errorf("span names = %q, %q, want %q", client.Name(), server.Name(), sayHelloMethod)
+				}
+
+				// Все span в одном trace, серверный span — удаленный потомок клиентского
+				traceID := client.SpanContext().TraceID()
+				for _, s := range []sdktrace.ReadOnlySpan{server, handler} {
+					if s.SpanContext().TraceID() != traceID {
+						t.Errorf("span %q trace id = %s, want %s", s.Name(), s.SpanContext().TraceID(), traceID)
+					}
+				}
+				if client.Parent().IsValid() {
+					t.Errorf("client span has unexpected parent %s", client.Parent().SpanID())
+				}
+				if server.Parent().SpanID() != client.SpanContext().SpanID() || !server.Parent().IsRemote() {
+					t.Errorf("server span parent = %v, want remote %s", server.Parent(), client.SpanContext().SpanID())
+				}
+				if handler.Parent().SpanID() != server.SpanContext().SpanID() {
+					t.Errorf("handler span parent = %s, want %s", handler.Parent().SpanID(), server.SpanContext().SpanID())
+				}
+
+				// Атрибуты
+				clientAttrs, serverAttrs := attrs(client), attrs(server)
+				for key, want := range map[attribute.Key]string{
+					"rpc.system":  "grpc",
+					"rpc.service": "Greeter",
+					"rpc.method":  sayHelloMethod,
+					"grpc.type":   "unary",
+				} {
+					if got := clientAttrs[key].AsString(); got != want {
+						t.Errorf("client attribute %s = %q, want %q", key, got, want)
+					}
+					if got := serverAttrs[key].AsString(); got != want {
+						t.Errorf("server attribute %s = %q, want %q", key, got, want)
+					}
+				}
+				// Адрес соединения и выбранный адрес сервера
+				if got := clientAttrs["net.peer.name"].AsString(); got != testTarget {
+					t.Errorf("client attribute net.peer.name = %q, want %q", got, testTarget)
+				}
+				if got := clientAttrs["net.sock.peer.addr"].AsString(); got != "bufconn" {
+					t.Errorf("client attribute net.sock.peer.addr = %q, want %q", got, "bufconn")
+				}
+				// По истечении дедлайна клиент сбрасывает поток, и сервер может
+				// увидеть отмену раньше, чем сработает его собственный таймер
+				gotCode := codes.Code(serverAttrs["rpc.grpc.status_code"].AsInt64())
+				if gotCode != tt.wantCode && !(tt.timeout > 0 && gotCode == codes.Canceled) {
+					t.Errorf("server rpc.grpc.status_code = %v, want %v", gotCode, tt.wantCode)
+				}
+
+				// Статусы span
+				if got := client.Status().Code; got != tt.wantStatus {
+					t.Errorf("client span status = %v, want %v", got, tt.wantStatus)
+				}
+				if got := server.Status().Code; got != tt.wantStatus {
+					t.Errorf("server span status = %v, want %v", got, tt.wantStatus)
+				}
+				if tt.wantStatus == otelcodes.Error {
+					if !clientAttrs["error"].AsBool() {
+						t.Errorf("client span missing error=true attribute")
+					}
+					if !hasEvent(server, "exception") {
+						t.Errorf("server span missing exception event: %v", server.Events())
+					}
+				}
+
+				// Сервер возвращает trace id в заголовках, а при ошибке и в трейлерах;
+				// при отмене на стороне клиента ответ не доходит
+				if tt.timeout == 0 && !tt.cancel {
+					if got := grpctrace.MetadataCarrier(header).Get("x-trace-id"); got != traceID.String() {
+						t.Errorf("header x-trace-id = %q, want %q", got, traceID)
+					}
+					want := ""
+					if tt.wantCode != codes.OK {
+						want = traceID.String()
+					}
+					if got := grpctrace.MetadataCarrier(trailer).Get("x-trace-id"); got != want {
+						t.Errorf("trailer x-trace-id = %q, want %q", got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestWrappedCallTrailer проверяет, что обертка сервера, как и interceptor,
+// возвращает trace id в трейлерах неудачного вызова
+func TestWrappedCallTrailer(t *testing.T) {
+	env := startTestEnv(t, wrappers)
+
+	var trailer metadata.MD
+	_, err := env.client.SayHello(context.Background(), &pb.HelloRequest{Name: "error"}, grpc.Trailer(&trailer))
+	if got := status.Code(err); got != codes.NotFound {
+		t.Fatalf("SayHello() code = %v, want %v (err: %v)", got, codes.NotFound, err)
+	}
+
+	spans := env.waitForSpans(t, 3)
+	want := spans[trace.SpanKindServer.String()].SpanContext().TraceID().String()
+	if got := grpctrace.MetadataCarrier(trailer).Get("x-trace-id"); got != want {
+		t.Errorf("trailer x-trace-id = %q, want %q", got, want)
+	}
+}
+
+func hasEvent(s sdktrace.ReadOnlySpan, name string) bool {
+	for _, e := range s.Events() {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TestExportedSpans проверяет, что span вызова доходят по OTLP до коллектора
+// связанными и с ресурсом, как у server и client
+func TestExportedSpans(t *testing.T) {
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		t.Run(mode.String(), func(t *testing.T) {
+			env := startExportedTestEnv(t, mode)
+
+			if _, err := env.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+				t.Fatalf("SayHello() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := env.collector.WaitForSpans(ctx, 3); err != nil {
+				t.Fatalf("WaitForSpans() error = %v", err)
+			}
+			client := env.collector.Filter(func(s otlpfake.Span) bool { return s.Kind == tracepb.Span_SPAN_KIND_CLIENT })
+			server := env.collector.Filter(func(s otlpfake.Span) bool { return s.Kind == tracepb.Span_SPAN_KIND_SERVER })
+			if len(client) != 1 || len(server) != 1 {
+				t.Fatalf("got %d client and %d server spans, want 1 each", len(client), len(server))
+			}
+			if server[0].ParentSpanIDHex() != client[0].SpanIDHex() {
+				t.Errorf("server span parent = %s, want %s", server[0].ParentSpanIDHex(), client[0].SpanIDHex())
+			}
+			if got := env.collector.Trace(client[0].TraceIDHex()); len(got) != 3 {
+				t.Errorf("trace has %d spans, want 3", len(got))
+			}
+			if got := server[0].ServiceName(); got != "grpctrace-test" {
+				t.Errorf("service.name = %q, want grpctrace-test", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package grpctrace
+
+// Пакет hello импортирует grpctrace ради сгенерированных оберток, поэтому
+// тесты с его сообщениями живут во внешнем пакете grpctrace_test и получают
+// внутренние функции отсюда
+var (
+	AnnotatedAttributes = annotatedAttributes
+	RedactSensitive     = redactSensitive
+	RequestAttributes   = MethodPolicy.requestAttributes
+	ResponseAttributes  = MethodPolicy.responseAttributes
+	AddPayloadEvent     = (*PayloadCapture).addPayloadEvent
+)
@@ -0,0 +1,109 @@
+package grpctrace
+
+import (
+	"github.com/DifferentialOrange/go-tracing-example/traceopts"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Опции полей из proto/trace.proto:
+//
+//	string name = 1 [(trace.attribute) = "greeter.name"];
+//	string token = 2 [(trace.sensitive) = true];
+//
+// Поля с (trace.attribute) попадают в атрибуты span, значения полей с
+// (trace.sensitive) скрываются везде, где interceptors записывают сообщения.
+
+func fieldAttributeName(fd protoreflect.FieldDescriptor) string {
+	return proto.GetExtension(fd.Options(), traceopts.E_Attribute).(string)
+}
+
+func isSensitive(fd protoreflect.FieldDescriptor) bool {
+	return proto.GetExtension(fd.Options(), traceopts.E_Sensitive).(bool)
+}
+
+// annotatedAttributes собирает атрибуты из заполненных полей с опцией
+// (trace.attribute), в том числе во вложенных сообщениях
+func annotatedAttributes(msg interface{}) []attribute.KeyValue {
+	// Сообщения, сгенерированные protoc-gen-go-traced, умеют это без рефлексии
+	if t, ok := msg.(interface{ TraceAttributes() []attribute.KeyValue }); ok {
+		return t.TraceAttributes()
+	}
+
+	m, ok := msg.(proto.Message)
+	if !ok || m == nil {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	var walk func(m protoreflect.Message)
+	walk = func(m protoreflect.Message) {
+		// Range не гарантирует порядок полей, а атрибуты должны идти
+		// одинаково от вызова к вызову, поэтому обходим поля по описанию
+		fields := m.Descriptor().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			if !m.Has(fd) {
+				continue
+			}
+			v := m.Get(fd)
+			if name := fieldAttributeName(fd); name != "" {
+				attrs = append(attrs, fieldAttribute(name, fd, v))
+			}
+			if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() && !isSensitive(fd) {
+				walk(v.Message())
+			}
+		}
+	}
+	walk(m.ProtoReflect())
+	return attrs
+}
+
+// fieldAttribute переводит значение поля в атрибут с подходящим типом
+func fieldAttribute(key string, fd protoreflect.FieldDescriptor, v protoreflect.Value) attribute.KeyValue {
+	if isSensitive(fd) {
+		return attribute.String(key, RedactedValue)
+	}
+	if fd.IsList() || fd.IsMap() {
+		return attribute.String(key, v.String())
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return attribute.Bool(key, v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return attribute.Int64(key, v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return attribute.Int64(key, int64(v.Uint()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return attribute.Float64(key, v.Float())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return attribute.String(key, string(ev.Name()))
+		}
+		return attribute.Int64(key, int64(v.Enum()))
+	default:
+		return attribute.String(key, v.String())
+	}
+}
+
+// redactSensitive скрывает поля с опцией (trace.sensitive) во всем сообщении
+func redactSensitive(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case isSensitive(fd):
+			redactField(m, fd)
+		case fd.Kind() != protoreflect.MessageKind || fd.IsMap():
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				redactSensitive(list.Get(i).Message())
+			}
+		default:
+			redactSensitive(v.Message())
+		}
+		return true
+	})
+}
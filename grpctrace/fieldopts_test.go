@@ -0,0 +1,172 @@
+package grpctrace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"github.com/DifferentialOrange/go-tracing-example/traceopts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// loginRequest строит сообщение с секретным полем без отдельного .proto:
+//
+//	message LoginRequest {
+//	  string user = 1 [(trace.attribute) = "login.user"];
+//	  string password = 2 [(trace.sensitive) = true, (trace.attribute) = "login.password"];
+//	}
+func loginRequest(t *testing.T, user, password string) *dynamicpb.Message {
+	t.Helper()
+
+	userOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(userOpts, traceopts.E_Attribute, "login.user")
+	passwordOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(passwordOpts, traceopts.E_Sensitive, true)
+	proto.SetExtension(passwordOpts, traceopts.E_Attribute, "login.password")
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("login.proto"),
+		Package:    proto.String("login"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"proto/trace.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("LoginRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("user"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("user"),
+					Options:  userOpts,
+				},
+				{
+					Name:     proto.String("password"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					JsonName: proto.String("password"),
+					Options:  passwordOpts,
+				},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to build descriptor: %v", err)
+	}
+
+	md := file.Messages().ByName("LoginRequest")
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("user"), protoreflect.ValueOfString(user))
+	msg.Set(md.Fields().ByName("password"), protoreflect.ValueOfString(password))
+	return msg
+}
+
+func TestMethodPolicyFields(t *testing.T) {
+	policy := grpctrace.MethodPolicy{
+		RequestFields:  []string{"name", "missing"},
+		ResponseFields: []string{"message"},
+	}
+
+	got := grpctrace.RequestAttributes(policy, &pb.HelloRequest{Name: "Go Developer"}, nil)
+	want := []attribute.KeyValue{attribute.String("rpc.request.name", "Go Developer")}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("requestAttributes() = %v, want %v", got, want)
+	}
+
+	got = grpctrace.ResponseAttributes(policy, &pb.HelloResponse{Message: "Hello"}, nil)
+	want = []attribute.KeyValue{attribute.String("rpc.response.message", "Hello")}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("responseAttributes() = %v, want %v", got, want)
+	}
+}
+
+func TestRedactedPolicyFields(t *testing.T) {
+	policy := grpctrace.MethodPolicy{RequestFields: []string{"user", "password"}}
+	msg := loginRequest(t, "gopher", "secret")
+
+	got := grpctrace.RequestAttributes(policy, msg, []string{"user"})
+	want := []attribute.KeyValue{
+		attribute.String("rpc.request.user", grpctrace.RedactedValue),
+		attribute.String("rpc.request.password", grpctrace.RedactedValue),
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("requestAttributes() = %v, want %v", got, want)
+	}
+
+	// Совпадение начала имени не скрывает поле
+	policy = grpctrace.MethodPolicy{RequestFields: []string{"name"}}
+	req := &pb.HelloRequest{Name: "Go Developer"}
+	if got := grpctrace.RequestAttributes(policy, req, []string{"na"}); len(got) != 1 || got[0].Value.AsString() != "Go Developer" {
+		t.Errorf("requestAttributes() with redact na = %v, want name kept", got)
+	}
+
+	// Поля из -redact-fields не попадают в атрибуты и при записи через
+	// трассировку вызовов
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		t.Run(mode.String(), func(t *testing.T) {
+			env := startTestEnv(t, mode,
+				grpctrace.WithPolicies(grpctrace.Policies{{Pattern: "/hello.Greeter/*", RequestFields: []string{"name"}}}),
+				grpctrace.WithPayloadCapture(grpctrace.PayloadCapture{Redact: []string{"name"}}),
+			)
+			if _, err := env.client.SayHello(context.Background(), req); err != nil {
+				t.Fatalf("SayHello() error = %v", err)
+			}
+			server := env.waitForSpans(t, 3)[trace.SpanKindServer.String()]
+			if got := attrs(server)["rpc.request.name"].AsString(); got != grpctrace.RedactedValue {
+				t.Errorf("rpc.request.name = %q, want %q", got, grpctrace.RedactedValue)
+			}
+		})
+	}
+}
+
+func TestAnnotatedAttributes(t *testing.T) {
+	got := grpctrace.AnnotatedAttributes(&pb.HelloRequest{Name: "Go Developer"})
+	want := []attribute.KeyValue{attribute.String("greeter.name", "Go Developer")}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("grpctrace.AnnotatedAttributes(HelloRequest) = %v, want %v", got, want)
+	}
+
+	if got := grpctrace.AnnotatedAttributes(&pb.HelloResponse{Message: "Hello"}); len(got) != 0 {
+		t.Errorf("grpctrace.AnnotatedAttributes(HelloResponse) = %v, want none", got)
+	}
+
+	got = grpctrace.AnnotatedAttributes(loginRequest(t, "gopher", "secret"))
+	want = []attribute.KeyValue{
+		attribute.String("login.user", "gopher"),
+		attribute.String("login.password", grpctrace.RedactedValue),
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("grpctrace.AnnotatedAttributes(LoginRequest) = %v, want %v", got, want)
+	}
+}
+
+func TestSensitiveFields(t *testing.T) {
+	msg := loginRequest(t, "gopher", "secret")
+
+	// Политика не может вытащить секрет в атрибут
+	policy := grpctrace.MethodPolicy{RequestFields: []string{"password"}}
+	got := grpctrace.RequestAttributes(policy, msg, nil)
+	if len(got) != 1 || got[0].Value.AsString() != grpctrace.RedactedValue {
+		t.Errorf("requestAttributes() = %v, want password redacted", got)
+	}
+
+	// И в записанных сообщениях секрет скрыт
+	redacted := proto.Clone(msg)
+	grpctrace.RedactSensitive(redacted.ProtoReflect())
+	password := redacted.ProtoReflect().Descriptor().Fields().ByName("password")
+	if v := redacted.ProtoReflect().Get(password).String(); v != grpctrace.RedactedValue {
+		t.Errorf("password = %q, want %q", v, grpctrace.RedactedValue)
+	}
+	if v := msg.Get(password).String(); v != "secret" {
+		t.Errorf("original message was modified: password = %q", v)
+	}
+}
@@ -0,0 +1,46 @@
+package grpctrace_test
+
+import (
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"github.com/DifferentialOrange/go-tracing-example/spantree"
+	"google.golang.org/grpc/codes"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestUnaryCallGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		mode    instrumentation
+		opts    []grpctrace.Option
+	}{
+		{name: "unary_success", request: "Go Developer"},
+		{name: "unary_error", request: "error"},
+		{name: "wrapped_success", request: "Go Developer", mode: wrappers},
+		{name: "wrapped_error", request: "error", mode: wrappers},
+		// NotFound не входит в ErrorCodes политики, серверный span без Error
+		{name: "wrapped_expected_error", request: "error", mode: wrappers, opts: []grpctrace.Option{
+			grpctrace.WithPolicies(grpctrace.Policies{{Pattern: "/hello.Greeter/*", ErrorCodes: []codes.Code{codes.Internal}}}),
+		}},
+		{name: "stats_success", request: "Go Developer", mode: statsHandlers},
+		{name: "stats_error", request: "error", mode: statsHandlers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := startTestEnv(t, tt.mode, tt.opts...)
+
+			// Ошибка вызова ожидаема, сравниваем только span
+			_, _ = env.client.SayHello(context.Background(), &pb.HelloRequest{Name: tt.request})
+
+			env.waitForSpans(t, 3)
+			spantree.AssertGolden(t, tt.name, env.recorder.Ended(), *update)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package grpctrace
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Границы бакетов гистограммы задержек RPC в миллисекундах
+var rpcDurationBuckets = []float64{1, 5, 10, 25, 50, 75, 100, 150, 250, 500, 1000, 2500, 5000}
+
+// Metrics — гистограмма задержек RPC; nil означает, что метрики не пишутся
+type Metrics struct {
+	duration metric.Float64Histogram
+}
+
+// NewServerMetrics создает гистограмму rpc.server.duration
+func NewServerMetrics(meter metric.Meter) (*Metrics, error) {
+	return newMetrics(meter, "rpc.server.duration", "Measures the duration of inbound RPC.")
+}
+
+// NewClientMetrics создает гистограмму rpc.client.duration
+func NewClientMetrics(meter metric.Meter) (*Metrics, error) {
+	return newMetrics(meter, "rpc.client.duration", "Measures the duration of outbound RPC.")
+}
+
+func newMetrics(meter metric.Meter, name, description string) (*Metrics, error) {
+	duration, err := meter.Float64Histogram(name,
+		metric.WithDescription(description),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(rpcDurationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Metrics{duration: duration}, nil
+}
+
+// ctx должен содержать span вызова: из него SDK берет trace id для exemplar
+func (m *Metrics) record(ctx context.Context, elapsed time.Duration, attrs ...attribute.KeyValue) {
+	if m == nil {
+		return
+	}
+	m.duration.Record(ctx,
+		float64(elapsed)/float64(time.Millisecond),
+		metric.WithAttributes(attrs...),
+	)
+}
@@ -0,0 +1,69 @@
+package grpctrace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+func TestLatencyExemplars(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	metrics, err := grpctrace.NewServerMetrics(mp.Meter("grpctrace-test"))
+	if err != nil {
+		t.Fatalf("NewServerMetrics() error = %v", err)
+	}
+
+	tracer := sdktrace.NewTracerProvider().Tracer("grpctrace-test")
+	interceptor := grpctrace.UnaryServerInterceptor(tracer, metrics)
+
+	var sc trace.SpanContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		sc = trace.SpanContextFromContext(ctx)
+		return &pb.HelloResponse{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: sayHelloMethod}
+	if _, err := interceptor(context.Background(), &pb.HelloRequest{Name: "Go Developer"}, info, handler); err != nil {
+		t.Fatalf("interceptor error = %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	var exemplars []metricdata.Exemplar[float64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "rpc.server.duration" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			if !ok {
+				t.Fatalf("rpc.server.duration data = %T, want histogram", m.Data)
+			}
+			for _, dp := range hist.DataPoints {
+				exemplars = append(exemplars, dp.Exemplars...)
+			}
+		}
+	}
+
+	// Exemplar связывает бакет с span вызова
+	if len(exemplars) != 1 {
+		t.Fatalf("got %d exemplars, want 1", len(exemplars))
+	}
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	if got := exemplars[0].TraceID; string(got) != string(traceID[:]) {
+		t.Errorf("exemplar trace id = %x, want %s", got, traceID)
+	}
+	if got := exemplars[0].SpanID; string(got) != string(spanID[:]) {
+		t.Errorf("exemplar span id = %x, want %s", got, spanID)
+	}
+}
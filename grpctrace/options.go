@@ -0,0 +1,48 @@
+package grpctrace
+
+import "github.com/DifferentialOrange/go-tracing-example/repro"
+
+// Option настраивает interceptors
+type Option func(*config)
+
+type config struct {
+	policies Policies
+	payload  *PayloadCapture
+	redact   []string
+	clock    repro.Clock
+	trust    *TrustPolicy
+	debug    *DebugPolicy
+	peerName string
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{policies: DefaultPolicies, clock: repro.RealClock{}}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithPolicies задает таблицу политик по методам вместо DefaultPolicies
+func WithPolicies(policies Policies) Option {
+	return func(c *config) { c.policies = policies }
+}
+
+// WithRedactFields скрывает поля сообщений (пути через точку, как в
+// PayloadCapture.Redact) в атрибутах rpc.request.* и rpc.response.*
+func WithRedactFields(paths ...string) Option {
+	return func(c *config) { c.redact = append(c.redact, paths...) }
+}
+
+// WithPeerName задает атрибут net.peer.name клиентских span — адрес
+// соединения, как его передали в grpc.NewClient. UnaryClientInterceptor
+// берет адрес из соединения сам, а stats.Handler и обертки его не видят.
+func WithPeerName(target string) Option {
+	return func(c *config) { c.peerName = target }
+}
+
+// WithClock задает часы для времени span, событий и задержек в метриках,
+// например repro.FakeClock для воспроизводимых trace
+func WithClock(clock repro.Clock) Option {
+	return func(c *config) { c.clock = clock }
+}
@@ -0,0 +1,133 @@
+package grpctrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RedactedValue заменяет значения скрытых строковых полей
+const RedactedValue = "[REDACTED]"
+
+// DefaultPayloadMaxSize — ограничение размера JSON сообщения в событии
+const DefaultPayloadMaxSize = 4096
+
+// PayloadCapture задает запись сообщений запроса и ответа в события span
+type PayloadCapture struct {
+	// MaxSize — максимальный размер JSON в байтах, длиннее обрезается
+	MaxSize int
+	// Redact — пути полей через точку (имена полей proto), значения которых
+	// скрываются, например "password" или "user.credentials.token"
+	Redact []string
+}
+
+// WithPayloadCapture включает запись сообщений в события span. По умолчанию
+// сообщения не записываются: в них могут быть персональные данные.
+func WithPayloadCapture(capture PayloadCapture) Option {
+	return func(c *config) {
+		if capture.MaxSize <= 0 {
+			capture.MaxSize = DefaultPayloadMaxSize
+		}
+		c.payload = &capture
+		// Поля, скрытые в событиях, не должны попасть и в атрибуты политик
+		c.redact = append(c.redact, capture.Redact...)
+	}
+}
+
+// addPayloadEvent добавляет событие rpc.payload с сообщением msg в виде JSON.
+// messageType — RECEIVED или SENT с точки зрения стороны, пишущей span.
+func (c *PayloadCapture) addPayloadEvent(span trace.Span, messageType string, msg interface{}, now time.Time) {
+	if c == nil || !span.IsRecording() {
+		return
+	}
+	m, ok := msg.(proto.Message)
+	if !ok || m == nil {
+		return
+	}
+
+	// Скрываем поля в копии, чтобы не испортить настоящее сообщение
+	m = proto.Clone(m)
+	redactSensitive(m.ProtoReflect())
+	for _, path := range c.Redact {
+		redact(m.ProtoReflect(), strings.Split(path, "."))
+	}
+
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		span.AddEvent("rpc.payload", trace.WithTimestamp(now), trace.WithAttributes(
+			attribute.String("rpc.message.type", messageType),
+			attribute.String("rpc.message.error", err.Error()),
+		))
+		return
+	}
+
+	// protojson намеренно добавляет случайные пробелы, убираем их, чтобы
+	// одинаковые сообщения давали одинаковые события
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err == nil {
+		data = compact.Bytes()
+	}
+
+	payload, truncated := truncate(string(data), c.MaxSize)
+	span.AddEvent("rpc.payload", trace.WithTimestamp(now), trace.WithAttributes(
+		attribute.String("rpc.message.type", messageType),
+		attribute.String("rpc.message.payload", payload),
+		attribute.Int("rpc.message.size", len(data)),
+		attribute.Bool("rpc.message.truncated", truncated),
+	))
+}
+
+// redact скрывает поле по пути names; повторяющиеся сообщения обходятся целиком
+func redact(m protoreflect.Message, names []string) {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(names[0]))
+	if fd == nil || !m.Has(fd) {
+		return
+	}
+
+	if len(names) > 1 {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return
+		}
+		if fd.IsList() {
+			list := m.Get(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				redact(list.Get(i).Message(), names[1:])
+			}
+			return
+		}
+		redact(m.Get(fd).Message(), names[1:])
+		return
+	}
+
+	redactField(m, fd)
+}
+
+// redactField скрывает значение поля. Строки заменяются меткой, чтобы было
+// видно, что поле было заполнено; остальные типы просто очищаются.
+func redactField(m protoreflect.Message, fd protoreflect.FieldDescriptor) {
+	if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+		m.Set(fd, protoreflect.ValueOfString(RedactedValue))
+		return
+	}
+	m.Clear(fd)
+}
+
+// truncate обрезает s до limit байт, не разрывая символы UTF-8
+func truncate(s string, limit int) (string, bool) {
+	if len(s) <= limit {
+		return s, false
+	}
+	s = s[:limit]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s, true
+}
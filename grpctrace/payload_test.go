@@ -0,0 +1,116 @@
+package grpctrace_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPayloadCapture(t *testing.T) {
+	tests := []struct {
+		name          string
+		capture       grpctrace.PayloadCapture
+		wantPayload   string
+		wantTruncated bool
+	}{
+		{
+			name:        "plain",
+			capture:     grpctrace.PayloadCapture{MaxSize: grpctrace.DefaultPayloadMaxSize},
+			wantPayload: `{"name":"Go Developer"}`,
+		},
+		{
+			name:        "redacted",
+			capture:     grpctrace.PayloadCapture{MaxSize: grpctrace.DefaultPayloadMaxSize, Redact: []string{"name", "unknown.field"}},
+			wantPayload: `{"name":"[REDACTED]"}`,
+		},
+		{
+			name:          "truncated",
+			capture:       grpctrace.PayloadCapture{MaxSize: 10},
+			wantPayload:   `{"name":"G`,
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			_, span := tp.Tracer("test").Start(context.Background(), "span")
+
+			req := &pb.HelloRequest{Name: "Go Developer"}
+			grpctrace.AddPayloadEvent(&tt.capture, span, "RECEIVED", req, time.Now())
+			span.End()
+
+			if req.Name != "Go Developer" {
+				t.Errorf("request was modified: %q", req.Name)
+			}
+
+			events := recorder.Ended()[0].Events()
+			if len(events) != 1 || events[0].Name != "rpc.payload" {
+				t.Fatalf("events = %v, want one rpc.payload event", events)
+			}
+			got := make(map[attribute.Key]attribute.Value)
+			for _, kv := range events[0].Attributes {
+				got[kv.Key] = kv.Value
+			}
+			if payload := got["rpc.message.payload"].AsString(); payload != tt.wantPayload {
+				t.Errorf("payload = %q, want %q", payload, tt.wantPayload)
+			}
+			if truncated := got["rpc.message.truncated"].AsBool(); truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if got["rpc.message.type"].AsString() != "RECEIVED" {
+				t.Errorf("message type = %q, want RECEIVED", got["rpc.message.type"].AsString())
+			}
+		})
+	}
+}
+
+func TestPayloadEvents(t *testing.T) {
+	capture := grpctrace.WithPayloadCapture(grpctrace.PayloadCapture{
+		MaxSize: grpctrace.DefaultPayloadMaxSize,
+		Redact:  []string{"name"},
+	})
+
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		t.Run(mode.String(), func(t *testing.T) {
+			env := startTestEnv(t, mode, capture)
+
+			if _, err := env.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+				t.Fatalf("SayHello() error = %v", err)
+			}
+
+			server := env.waitForSpans(t, 3)[trace.SpanKindServer.String()]
+			payloads := make(map[string]string)
+			for _, e := range server.Events() {
+				if e.Name != "rpc.payload" {
+					continue
+				}
+				var typ, payload string
+				for _, kv := range e.Attributes {
+					switch kv.Key {
+					case "rpc.message.type":
+						typ = kv.Value.AsString()
+					case "rpc.message.payload":
+						payload = kv.Value.AsString()
+					}
+				}
+				payloads[typ] = payload
+			}
+
+			if got, want := payloads["RECEIVED"], `{"name":"[REDACTED]"}`; got != want {
+				t.Errorf("RECEIVED payload = %q, want %q", got, want)
+			}
+			if got, want := payloads["SENT"], `{"message":"Hello, Go Developer"}`; got != want {
+				t.Errorf("SENT payload = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package grpctrace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MethodPolicy задает, как трассировать методы, подходящие под Pattern
+type MethodPolicy struct {
+	// Pattern — полное имя метода или glob в синтаксисе path.Match,
+	// например "/hello.Greeter/*"
+	Pattern string `json:"pattern"`
+	// Disabled отключает span и метрики для метода
+	Disabled bool `json:"disabled,omitempty"`
+	// SpanName — формат имени span с подстановками {full_method}, {service}
+	// и {method}; по умолчанию {full_method}
+	SpanName string `json:"span_name,omitempty"`
+	// RequestFields и ResponseFields — поля сообщений (через точку для
+	// вложенных), которые записываются в атрибуты rpc.request.* и rpc.response.*
+	RequestFields  []string `json:"request_fields,omitempty"`
+	ResponseFields []string `json:"response_fields,omitempty"`
+	// ErrorCodes — коды gRPC, при которых span получает статус Error;
+	// если не заданы, ошибкой считается любой код, кроме OK
+	ErrorCodes []codes.Code `json:"error_codes,omitempty"`
+}
+
+// Policies — таблица политик; применяется первая подходящая
+type Policies []MethodPolicy
+
+// DefaultPolicies не трассирует служебные сервисы health и reflection
+var DefaultPolicies = Policies{
+	{Pattern: "/grpc.health.v1.Health/*", Disabled: true},
+	{Pattern: "/grpc.reflection.*/*", Disabled: true},
+}
+
+// LoadPolicies читает таблицу политик из JSON файла. Политики по умолчанию
+// добавляются в конец, так что файл может их переопределить.
+func LoadPolicies(file string) (Policies, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies Policies
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, p := range policies {
+		if _, err := path.Match(p.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", file, p.Pattern, err)
+		}
+	}
+
+	return append(policies, DefaultPolicies...), nil
+}
+
+// Lookup возвращает политику для метода или пустую политику по умолчанию
+func (p Policies) Lookup(fullMethod string) MethodPolicy {
+	for _, policy := range p {
+		if ok, _ := path.Match(policy.Pattern, fullMethod); ok {
+			return policy
+		}
+	}
+	return MethodPolicy{}
+}
+
+// splitMethod разбивает "/package.Service/Method" на сервис и метод
+func splitMethod(fullMethod string) (service, method string) {
+	service, method, _ = strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, method
+}
+
+// shortService возвращает имя сервиса без пакета: "hello.Greeter" -> "Greeter"
+func shortService(service string) string {
+	return service[strings.LastIndex(service, ".")+1:]
+}
+
+func (p MethodPolicy) spanName(fullMethod string) string {
+	if p.SpanName == "" {
+		return fullMethod
+	}
+	service, method := splitMethod(fullMethod)
+	return strings.NewReplacer(
+		"{full_method}", fullMethod,
+		"{service}", service,
+		"{method}", method,
+	).Replace(p.SpanName)
+}
+
+// isError сообщает, считать ли код ошибкой для статуса span
+func (p MethodPolicy) isError(code codes.Code) bool {
+	if code == codes.OK {
+		return false
+	}
+	if len(p.ErrorCodes) == 0 {
+		return true
+	}
+	for _, c := range p.ErrorCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p MethodPolicy) requestAttributes(msg interface{}, redact []string) []attribute.KeyValue {
+	return fieldAttributes("rpc.request.", p.RequestFields, msg, redact)
+}
+
+func (p MethodPolicy) responseAttributes(msg interface{}, redact []string) []attribute.KeyValue {
+	return fieldAttributes("rpc.response.", p.ResponseFields, msg, redact)
+}
+
+// fieldAttributes достает поля protobuf сообщения по именам через protoreflect;
+// значения полей из redact и вложенных в них заменяются на RedactedValue
+func fieldAttributes(prefix string, fields []string, msg interface{}, redact []string) []attribute.KeyValue {
+	m, ok := msg.(proto.Message)
+	if !ok || len(fields) == 0 {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	for _, field := range fields {
+		value, ok := lookupField(m.ProtoReflect(), field)
+		if !ok {
+			continue
+		}
+		if isRedacted(field, redact) {
+			value = RedactedValue
+		}
+		attrs = append(attrs, attribute.String(prefix+field, value))
+	}
+	return attrs
+}
+
+// isRedacted сообщает, скрыто ли поле fieldPath само или вместе с родителем
+func isRedacted(fieldPath string, redact []string) bool {
+	for _, r := range redact {
+		if fieldPath == r || strings.HasPrefix(fieldPath, r+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupField(m protoreflect.Message, fieldPath string) (string, bool) {
+	names := strings.Split(fieldPath, ".")
+	for i, name := range names {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || !m.Has(fd) {
+			return "", false
+		}
+		if isSensitive(fd) {
+			return RedactedValue, true
+		}
+		value := m.Get(fd)
+		if i == len(names)-1 {
+			return value.String(), true
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return "", false
+		}
+		m = value.Message()
+	}
+	return "", false
+}
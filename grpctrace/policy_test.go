@@ -0,0 +1,58 @@
+package grpctrace
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestPoliciesLookup(t *testing.T) {
+	policies := append(Policies{
+		{Pattern: "/hello.Greeter/SayHello", SpanName: "{service}.{method}"},
+		{Pattern: "/hello.*/*", Disabled: true},
+	}, DefaultPolicies...)
+
+	tests := []struct {
+		method       string
+		wantDisabled bool
+		wantSpanName string
+	}{
+		{method: "/hello.Greeter/SayHello", wantSpanName: "hello.Greeter.SayHello"},
+		{method: "/hello.Greeter/SayGoodbye", wantDisabled: true, wantSpanName: "/hello.Greeter/SayGoodbye"},
+		{method: "/grpc.health.v1.Health/Check", wantDisabled: true, wantSpanName: "/grpc.health.v1.Health/Check"},
+		{method: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", wantDisabled: true, wantSpanName: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"},
+		{method: "/other.Service/Call", wantSpanName: "/other.Service/Call"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			policy := policies.Lookup(tt.method)
+			if policy.Disabled != tt.wantDisabled {
+				t.Errorf("Disabled = %v, want %v", policy.Disabled, tt.wantDisabled)
+			}
+			if got := policy.spanName(tt.method); got != tt.wantSpanName {
+				t.Errorf("spanName() = %q, want %q", got, tt.wantSpanName)
+			}
+		})
+	}
+}
+
+func TestMethodPolicyIsError(t *testing.T) {
+	all := MethodPolicy{}
+	serverFaults := MethodPolicy{ErrorCodes: []codes.Code{codes.Internal, codes.Unavailable}}
+
+	for _, tt := range []struct {
+		policy MethodPolicy
+		code   codes.Code
+		want   bool
+	}{
+		{all, codes.OK, false},
+		{all, codes.NotFound, true},
+		{serverFaults, codes.NotFound, false},
+		{serverFaults, codes.Internal, true},
+	} {
+		if got := tt.policy.isError(tt.code); got != tt.want {
+			t.Errorf("isError(%v) with %v = %v, want %v", tt.code, tt.policy.ErrorCodes, got, tt.want)
+		}
+	}
+}
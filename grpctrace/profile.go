@@ -0,0 +1,34 @@
+package grpctrace
+
+import (
+	"context"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Метки pprof, которыми помечается обработка вызова
+const (
+	SpanIDLabel = "span_id"
+	MethodLabel = "rpc.method"
+)
+
+// runProfiled выполняет fn с метками pprof span_id и rpc.method (их наследуют
+// и запущенные из fn горутины) внутри задачи и области runtime/trace с именем
+// span. Так CPU профиль можно разрезать по методам и запросам, а в трассе
+// исполнения найти задачу по trace id.
+func runProfiled(ctx context.Context, spanName, method string, fn func(context.Context)) {
+	sc := trace.SpanContextFromContext(ctx)
+
+	ctx, task := rtrace.NewTask(ctx, spanName)
+	defer task.End()
+	if rtrace.IsEnabled() {
+		rtrace.Log(ctx, "trace_id", sc.TraceID().String())
+		rtrace.Log(ctx, SpanIDLabel, sc.SpanID().String())
+	}
+
+	pprof.Do(ctx, pprof.Labels(SpanIDLabel, sc.SpanID().String(), MethodLabel, method), func(ctx context.Context) {
+		rtrace.WithRegion(ctx, spanName, func() { fn(ctx) })
+	})
+}
@@ -0,0 +1,59 @@
+package grpctrace_test
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProfilerLabels(t *testing.T) {
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		t.Run(mode.String(), func(t *testing.T) {
+			env := startTestEnv(t, mode)
+
+			var (
+				spanID  string
+				labels  = make(map[string]string)
+				profile bytes.Buffer
+			)
+			env.greeter.onCall = func(ctx context.Context) {
+				spanID = trace.SpanContextFromContext(ctx).SpanID().String()
+				pprof.ForLabels(ctx, func(key, value string) bool {
+					labels[key] = value
+					return true
+				})
+				// Метки горутины видны только в профиле
+				_ = pprof.Lookup("goroutine").WriteTo(&profile, 1)
+			}
+
+			if _, err := env.client.SayHello(context.Background(), &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+				t.Fatalf("SayHello() error = %v", err)
+			}
+
+			if labels[grpctrace.SpanIDLabel] != spanID || spanID == "" {
+				t.Errorf("%s label = %q, want server span id %q", grpctrace.SpanIDLabel, labels[grpctrace.SpanIDLabel], spanID)
+			}
+			if labels[grpctrace.MethodLabel] != sayHelloMethod {
+				t.Errorf("%s label = %q, want %q", grpctrace.MethodLabel, labels[grpctrace.MethodLabel], sayHelloMethod)
+			}
+
+			// Метки должны стоять на горутине обработчика, а не только в контексте
+			want := `"` + grpctrace.SpanIDLabel + `":"` + spanID + `"`
+			for _, record := range strings.Split(profile.String(), "\n\n") {
+				if strings.Contains(record, "(*greeter).SayHello") {
+					if !strings.Contains(record, want) {
+						t.Errorf("handler goroutine has no %s label:\n%s", want, record)
+					}
+					return
+				}
+			}
+			t.Fatalf("handler goroutine not found in profile:\n%s", profile.String())
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package grpctrace
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TraceResponseMetadata формирует заголовки x-trace-id и traceresponse
+// (W3C Trace Context Level 2) для span серверной обработки
+func TraceResponseMetadata(sc trace.SpanContext) metadata.MD {
+	return metadata.Pairs(
+		"x-trace-id", sc.TraceID().String(),
+		"traceresponse", fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags()),
+	)
+}
+
+// startServerSpan — общее начало серверного span для interceptor, stats
+// handler и оберток. Контекст клиента продолжается с учетом TrustPolicy,
+// флаг отладки — с учетом DebugPolicy, арендатор попадает в контекст до
+// создания span, потому что от него зависит семплирование. Для метода,
+// отключенного политикой, span равен nil, а ctx все равно подготовлен.
+func (c *config) startServerSpan(ctx context.Context, tracer trace.Tracer, method string, opts ...trace.SpanStartOption) (context.Context, trace.Span, MethodPolicy) {
+	// Недоверенный клиент получает новый trace со ссылкой на свой
+	ctx, links := c.trust.extract(ctx)
+	// Проверенный флаг отладки включает семплирование всего trace
+	ctx = c.debug.extract(ctx, c.trust)
+
+	tenantID := tenant.FromIncomingContext(ctx)
+	ctx = tenant.ContextWithTenant(ctx, tenantID)
+
+	policy := c.policies.Lookup(method)
+	if policy.Disabled {
+		return ctx, nil, policy
+	}
+
+	// Атрибуты gRPC передаем сразу, чтобы семплер мог выбрать правило по
+	// rpc.method
+	opts = append([]trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(c.clock.Now()),
+		trace.WithLinks(links...),
+		trace.WithAttributes(rpcAttributes(method)...),
+	}, opts...)
+	ctx, span := tracer.Start(ctx, policy.spanName(method), opts...)
+	if tenantID != "" {
+		span.SetAttributes(tenant.AttributeKey.String(tenantID))
+	}
+	return ctx, span, policy
+}
+
+// UnaryServerInterceptor создает span для каждого входящего вызова, продолжая
+// trace из метаданных клиента, и пишет задержку в metrics. Что и как
+// трассировать для каждого метода, задают политики (см. WithPolicies).
+func UnaryServerInterceptor(tracer trace.Tracer, metrics *Metrics, opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := newConfig(opts)
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, span, policy := cfg.startServerSpan(ctx, tracer, info.FullMethod)
+		if span == nil {
+			return handler(ctx, req)
+		}
+		defer func() { span.End(trace.WithTimestamp(cfg.clock.Now())) }()
+
+		span.SetAttributes(policy.requestAttributes(req, cfg.redact)...)
+		span.SetAttributes(annotatedAttributes(req)...)
+		cfg.payload.addPayloadEvent(span, "RECEIVED", req, cfg.clock.Now())
+
+		// Сообщаем вызывающему идентификатор trace в заголовках ответа
+		if err := grpc.SetHeader(ctx, TraceResponseMetadata(span.SpanContext())); err != nil {
+			slog.Warn("Failed to set trace response header", "error", err)
+		}
+
+		// Обрабатываем запрос с метками pprof и в задаче runtime/trace
+		start := cfg.clock.Now()
+		var (
+			resp interface{}
+			err  error
+		)
+		runProfiled(ctx, policy.spanName(info.FullMethod), info.FullMethod, func(ctx context.Context) {
+			resp, err = handler(ctx, req)
+		})
+
+		// Записываем задержку; exemplar свяжет бакет с текущим trace
+		metrics.record(ctx, cfg.clock.Now().Sub(start),
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", info.FullMethod),
+			attribute.Int("rpc.grpc.status_code", int(status.Code(err))),
+		)
+
+		// Обрабатываем результат
+		cfg.setServerStatus(ctx, span, policy, err)
+		if err == nil {
+			span.SetAttributes(policy.responseAttributes(resp, cfg.redact)...)
+			span.SetAttributes(annotatedAttributes(resp)...)
+			cfg.payload.addPayloadEvent(span, "SENT", resp, cfg.clock.Now())
+		}
+
+		return resp, err
+	}
+}
+
+// setServerStatus записывает в серверный span код gRPC и статус по политике
+// метода; коды, которые политика не считает ошибкой, оставляют статус Unset.
+// Общий для interceptor и оберток.
+func (c *config) setServerStatus(ctx context.Context, span trace.Span, policy MethodPolicy, err error) {
+	if err == nil {
+		span.SetStatus(codes.Ok, "success")
+		span.SetAttributes(attribute.Int("rpc.grpc.status_code", 0)) // OK
+		return
+	}
+
+	setErrorTrailer(ctx, span)
+	if s, ok := status.FromError(err); ok {
+		span.SetAttributes(
+			attribute.Int("rpc.grpc.status_code", int(s.Code())),
+			attribute.String("rpc.grpc.status_message", s.Message()),
+		)
+	}
+	if policy.isError(status.Code(err)) {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err, trace.WithTimestamp(c.clock.Now()))
+	}
+}
+
+// setErrorTrailer дублирует trace id в трейлеры неудачного вызова: при
+// ошибке заголовки могут не дойти до клиента. Если вызов отменен, поток уже
+// закрыт и отвечать некому.
+func setErrorTrailer(ctx context.Context, span trace.Span) {
+	if ctx.Err() != nil {
+		return
+	}
+	if err := grpc.SetTrailer(ctx, TraceResponseMetadata(span.SpanContext())); err != nil {
+		slog.Warn("Failed to set trace response trailer", "error", err)
+	}
+}
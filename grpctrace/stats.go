@@ -0,0 +1,293 @@
+package grpctrace
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// rpcState — span вызова и счетчики сообщений между событиями stats.Handler
+type rpcState struct {
+	span   trace.Span
+	policy MethodPolicy
+	method string
+	start  time.Time
+
+	sent     atomic.Int64
+	received atomic.Int64
+
+	// Только на клиенте: заголовки и трейлеры ответа приходят в горутине
+	// чтения транспорта и могут обогнать отправку запроса и разбор ответа.
+	// Чтобы порядок событий не зависел от планировщика, заголовки
+	// добавляем перед первым сообщением ответа, трейлеры — в End, оба со
+	// временем получения.
+	mu      sync.Mutex
+	header  *deferredEvent
+	trailer *deferredEvent
+}
+
+type deferredEvent struct {
+	name  string
+	at    time.Time
+	attrs []attribute.KeyValue
+}
+
+// flush добавляет в span отложенное событие *ev, если оно есть
+func (st *rpcState) flush(ev **deferredEvent) {
+	st.mu.Lock()
+	e := *ev
+	*ev = nil
+	st.mu.Unlock()
+	if e != nil {
+		st.span.AddEvent(e.name, trace.WithTimestamp(e.at), trace.WithAttributes(e.attrs...))
+	}
+}
+
+func (st *rpcState) store(ev **deferredEvent, e *deferredEvent) {
+	st.mu.Lock()
+	*ev = e
+	st.mu.Unlock()
+}
+
+type rpcStateKey struct{}
+
+func stateFromContext(ctx context.Context) *rpcState {
+	st, _ := ctx.Value(rpcStateKey{}).(*rpcState)
+	return st
+}
+
+// statsHandler — общая часть клиентского и серверного stats.Handler
+type statsHandler struct {
+	tracer  trace.Tracer
+	metrics *Metrics
+	cfg     *config
+	client  bool
+}
+
+// NewServerHandler возвращает stats.Handler для grpc.StatsHandler. Он делает
+// то же, что UnaryServerInterceptor, и вдобавок записывает в span события,
+// которых interceptor не видит: получение и отправку заголовков и трейлеров,
+// размеры сообщений до и после сжатия и начало работы обработчика. Метки
+// pprof и трейлеры при ошибке добавляет StatsServerInterceptor.
+func NewServerHandler(tracer trace.Tracer, metrics *Metrics, opts ...Option) stats.Handler {
+	return &statsHandler{tracer: tracer, metrics: metrics, cfg: newConfig(opts)}
+}
+
+// NewClientHandler возвращает stats.Handler для grpc.WithStatsHandler —
+// замену UnaryClientInterceptor с теми же событиями, что у NewServerHandler
+func NewClientHandler(tracer trace.Tracer, metrics *Metrics, opts ...Option) stats.Handler {
+	return &statsHandler{tracer: tracer, metrics: metrics, cfg: newConfig(opts), client: true}
+}
+
+func (h *statsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *statsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// TagRPC начинает span. Контекст, который он возвращает, gRPC использует
+// для всего вызова: на клиенте из него берутся исходящие метаданные, на
+// сервере он становится контекстом обработчика.
+func (h *statsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	if h.client {
+		return h.tagClientRPC(ctx, info.FullMethodName)
+	}
+	return h.tagServerRPC(ctx, info.FullMethodName)
+}
+
+func (h *statsHandler) tagClientRPC(ctx context.Context, method string) context.Context {
+	policy := h.cfg.policies.Lookup(method)
+	if policy.Disabled {
+		return InjectSpanContext(ctx)
+	}
+
+	ctx, span := h.tracer.Start(ctx, policy.spanName(method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(h.cfg.clock.Now()),
+		trace.WithAttributes(rpcAttributes(method)...),
+	)
+	if h.cfg.peerName != "" {
+		span.SetAttributes(attribute.String("net.peer.name", h.cfg.peerName))
+	}
+
+	// Передаем арендатора отдельным заголовком для сервисов без baggage
+	if tenantID := tenant.FromContext(ctx); tenantID != "" {
+		span.SetAttributes(tenant.AttributeKey.String(tenantID))
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, tenantID)
+	}
+
+	st := &rpcState{span: span, policy: policy, method: method, start: h.cfg.clock.Now()}
+	return InjectSpanContext(context.WithValue(ctx, rpcStateKey{}, st))
+}
+
+func (h *statsHandler) tagServerRPC(ctx context.Context, method string) context.Context {
+	ctx, span, policy := h.cfg.startServerSpan(ctx, h.tracer, method)
+	if span == nil {
+		return ctx
+	}
+
+	st := &rpcState{span: span, policy: policy, method: method, start: h.cfg.clock.Now()}
+	return context.WithValue(ctx, rpcStateKey{}, st)
+}
+
+// StatsServerInterceptor дополняет NewServerHandler тем, чего stats.Handler
+// сделать не может: TagRPC работает в горутине транспорта, а не обработчика,
+// и между ответом обработчика и записью трейлеров событий нет. Interceptor
+// выполняет обработчик с метками pprof и в задаче runtime/trace, а при
+// ошибке дублирует trace id в трейлеры. Без NewServerHandler он просто
+// вызывает обработчик.
+func StatsServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		st := stateFromContext(ctx)
+		if st == nil {
+			return handler(ctx, req)
+		}
+
+		var (
+			resp interface{}
+			err  error
+		)
+		runProfiled(ctx, st.policy.spanName(st.method), st.method, func(ctx context.Context) {
+			resp, err = handler(ctx, req)
+		})
+
+		if err != nil {
+			setErrorTrailer(ctx, st.span)
+		}
+		return resp, err
+	}
+}
+
+func (h *statsHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	st := stateFromContext(ctx)
+	if st == nil {
+		return
+	}
+	span := st.span
+	now := trace.WithTimestamp(h.cfg.clock.Now())
+
+	switch rs := rs.(type) {
+	case *stats.InHeader:
+		if h.client {
+			st.store(&st.header, &deferredEvent{name: "rpc.header.received", at: h.cfg.clock.Now(), attrs: compression(rs.Compression)})
+			break
+		}
+		span.AddEvent("rpc.header.received", now, trace.WithAttributes(compression(rs.Compression)...))
+		// Адрес, на котором принят вызов, различает экземпляры сервера
+		if rs.LocalAddr != nil {
+			span.SetAttributes(attribute.String("net.sock.host.addr", rs.LocalAddr.String()))
+		}
+	case *stats.OutHeader:
+		span.AddEvent("rpc.header.sent", now, trace.WithAttributes(compression(rs.Compression)...))
+		// Адрес, который выбрал балансировщик
+		if h.client && rs.RemoteAddr != nil {
+			span.SetAttributes(attribute.String("net.sock.peer.addr", rs.RemoteAddr.String()))
+		}
+	case *stats.InPayload:
+		st.flush(&st.header)
+		span.AddEvent("message", now, trace.WithAttributes(
+			attribute.String("message.type", "RECEIVED"),
+			attribute.Int64("message.id", st.received.Add(1)),
+			attribute.Int("message.compressed_size", rs.CompressedLength),
+			attribute.Int("message.uncompressed_size", rs.Length),
+		))
+		h.messageAttributes(st, rs.Payload, !h.client)
+		h.cfg.payload.addPayloadEvent(span, "RECEIVED", rs.Payload, h.cfg.clock.Now())
+		if !h.client {
+			h.handlerStarted(ctx, span)
+		}
+	case *stats.OutPayload:
+		span.AddEvent("message", now, trace.WithAttributes(
+			attribute.String("message.type", "SENT"),
+			attribute.Int64("message.id", st.sent.Add(1)),
+			attribute.Int("message.compressed_size", rs.CompressedLength),
+			attribute.Int("message.uncompressed_size", rs.Length),
+		))
+		h.messageAttributes(st, rs.Payload, h.client)
+		h.cfg.payload.addPayloadEvent(span, "SENT", rs.Payload, h.cfg.clock.Now())
+	case *stats.InTrailer:
+		st.store(&st.trailer, &deferredEvent{name: "rpc.trailer.received", at: h.cfg.clock.Now()})
+	case *stats.OutTrailer:
+		span.AddEvent("rpc.trailer.sent", now)
+	case *stats.End:
+		h.end(ctx, st, rs.Error)
+	}
+}
+
+// handlerStarted вызывается, когда запрос разобран и дальше работает
+// обработчик. Поток ответа появляется в контексте только здесь, поэтому и
+// заголовки с trace id ставим здесь; трейлеры при ошибке ставит
+// StatsServerInterceptor.
+func (h *statsHandler) handlerStarted(ctx context.Context, span trace.Span) {
+	if err := grpc.SetHeader(ctx, TraceResponseMetadata(span.SpanContext())); err != nil {
+		slog.Warn("Failed to set trace response header", "error", err)
+	}
+	span.AddEvent("rpc.handler.started", trace.WithTimestamp(h.cfg.clock.Now()))
+}
+
+// messageAttributes добавляет атрибуты полей сообщения: запроса по политике
+// запроса, ответа — по политике ответа
+func (h *statsHandler) messageAttributes(st *rpcState, msg interface{}, request bool) {
+	if request {
+		st.span.SetAttributes(st.policy.requestAttributes(msg, h.cfg.redact)...)
+	} else {
+		st.span.SetAttributes(st.policy.responseAttributes(msg, h.cfg.redact)...)
+	}
+	st.span.SetAttributes(annotatedAttributes(msg)...)
+}
+
+func (h *statsHandler) end(ctx context.Context, st *rpcState, err error) {
+	span := st.span
+	code := status.Code(err)
+
+	st.flush(&st.header)
+	st.flush(&st.trailer)
+
+	// Записываем задержку; exemplar свяжет бакет с текущим trace
+	h.metrics.record(ctx, h.cfg.clock.Now().Sub(st.start),
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", st.method),
+		attribute.Int("rpc.grpc.status_code", int(code)),
+	)
+
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if err != nil {
+		if s, ok := status.FromError(err); ok && !h.client {
+			span.SetAttributes(attribute.String("rpc.grpc.status_message", s.Message()))
+		}
+		// Коды, которые политика не считает ошибкой, оставляют статус Unset
+		if st.policy.isError(code) {
+			span.SetStatus(codes.Error, err.Error())
+			span.RecordError(err, trace.WithTimestamp(h.cfg.clock.Now()))
+			if h.client {
+				span.SetAttributes(attribute.Bool("error", true))
+			}
+		}
+	} else {
+		span.SetStatus(codes.Ok, "success")
+	}
+	span.End(trace.WithTimestamp(h.cfg.clock.Now()))
+}
+
+func compression(name string) []attribute.KeyValue {
+	if name == "" {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.String("rpc.grpc.compression", name)}
+}
@@ -0,0 +1,181 @@
+package grpctrace
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// TrustPolicy решает, можно ли продолжать trace вызывающего. Контекст
+// недоверенного клиента не становится родителем: серверный span начинает
+// новый trace со ссылкой (span link) на удаленный span, а из baggage
+// остаются только ключи из BaggageAllowList. Заголовок x-tenant-id — тот же
+// арендатор, что и tenant.id в baggage, поэтому от недоверенного клиента он
+// принимается, только если tenant.id есть в BaggageAllowList.
+//
+// Клиент считается доверенным, если он подходит под TrustedIdentities или
+// TrustedNetworks (когда они заданы) и передал заголовок authorization
+// (когда задан RequireAuth). Пустая политика доверяет всем.
+type TrustPolicy struct {
+	// TrustedIdentities — имена из клиентского сертификата mTLS: Common Name,
+	// DNS или URI из Subject Alternative Name
+	TrustedIdentities []string
+	// TrustedNetworks — диапазоны адресов доверенных клиентов
+	TrustedNetworks []netip.Prefix
+	// RequireAuth требует от доверенных клиентов заголовок authorization
+	RequireAuth bool
+	// BaggageAllowList — ключи baggage, которые принимаются от недоверенных
+	// клиентов; доверенные передают baggage целиком
+	BaggageAllowList []string
+}
+
+// WithTrustPolicy задает, каким клиентам сервер доверяет контекст трассировки
+func WithTrustPolicy(policy TrustPolicy) Option {
+	return func(c *config) { c.trust = &policy }
+}
+
+// ParseNetworks разбирает диапазоны адресов вида "10.0.0.0/8"; одиночный
+// адрес означает диапазон из одного адреса
+func ParseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, n := range networks {
+		if !strings.Contains(n, "/") {
+			addr, err := netip.ParseAddr(n)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", n, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", n, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// extract достает контекст трассировки из входящих метаданных с учетом
+// политики и возвращает ссылки для нового span
+func (p *TrustPolicy) extract(ctx context.Context) (context.Context, []trace.Link) {
+	ctx = ExtractSpanContext(ctx)
+	if p == nil || p.trusted(ctx) {
+		return ctx, nil
+	}
+
+	// Вместо родителя — ссылка на удаленный span
+	var links []trace.Link
+	if remote := trace.SpanContextFromContext(ctx); remote.IsValid() {
+		links = append(links, trace.Link{
+			SpanContext: remote,
+			Attributes:  []attribute.KeyValue{attribute.String("link.reason", "untrusted_peer")},
+		})
+	}
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+
+	ctx = baggage.ContextWithBaggage(ctx, p.filterBaggage(baggage.FromContext(ctx)))
+	return p.filterTenantHeader(ctx), links
+}
+
+func (p *TrustPolicy) trusted(ctx context.Context) bool {
+	if p.RequireAuth {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); len(values) == 0 || values[0] == "" {
+			return false
+		}
+	}
+	if len(p.TrustedIdentities) == 0 && len(p.TrustedNetworks) == 0 {
+		return true
+	}
+
+	pr, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	return p.trustedIdentity(pr.AuthInfo) || p.trustedAddr(pr.Addr)
+}
+
+func (p *TrustPolicy) trustedIdentity(info credentials.AuthInfo) bool {
+	tlsInfo, ok := info.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		// Непроверенному сертификату верить нельзя
+		return false
+	}
+	for _, identity := range certIdentities(tlsInfo.State.VerifiedChains[0][0]) {
+		for _, trusted := range p.TrustedIdentities {
+			if identity == trusted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func certIdentities(cert *x509.Certificate) []string {
+	identities := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+func (p *TrustPolicy) trustedAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range p.TrustedNetworks {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTenantHeader убирает x-tenant-id из входящих метаданных, если
+// арендатора нельзя принимать от недоверенного клиента
+func (p *TrustPolicy) filterTenantHeader(ctx context.Context) context.Context {
+	for _, key := range p.BaggageAllowList {
+		if key == tenant.BaggageKey {
+			return ctx
+		}
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(tenant.MetadataKey)) == 0 {
+		return ctx
+	}
+	md = md.Copy()
+	md.Delete(tenant.MetadataKey)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func (p *TrustPolicy) filterBaggage(bag baggage.Baggage) baggage.Baggage {
+	var members []baggage.Member
+	for _, key := range p.BaggageAllowList {
+		if m := bag.Member(key); m.Key() != "" {
+			members = append(members, m)
+		}
+	}
+	filtered, err := baggage.New(members...)
+	if err != nil {
+		return baggage.Baggage{}
+	}
+	return filtered
+}
@@ -0,0 +1,151 @@
+package grpctrace_test
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTrustPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      grpctrace.TrustPolicy
+		auth        bool
+		wantTrusted bool
+		wantBaggage string
+	}{
+		{
+			name:        "empty policy trusts everyone",
+			wantTrusted: true,
+			wantBaggage: "secret=42,tenant.id=acme",
+		},
+		{
+			name:        "authorized peer",
+			policy:      grpctrace.TrustPolicy{RequireAuth: true},
+			auth:        true,
+			wantTrusted: true,
+			wantBaggage: "secret=42,tenant.id=acme",
+		},
+		{
+			name:        "missing auth",
+			policy:      grpctrace.TrustPolicy{RequireAuth: true, BaggageAllowList: []string{"tenant.id"}},
+			wantBaggage: "tenant.id=acme",
+		},
+		{
+			// bufconn не дает IP адреса, поэтому клиент не попадает в сеть.
+			// Арендатор приходит еще и заголовком x-tenant-id, но tenant.id
+			// нет в списке, и заголовок отбрасывается вместе с baggage
+			name:   "unknown network",
+			policy: grpctrace.TrustPolicy{TrustedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}},
+			auth:   true,
+		},
+		{
+			name: "unknown network with tenant allowed",
+			policy: grpctrace.TrustPolicy{
+				TrustedNetworks:  []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+				BaggageAllowList: []string{"tenant.id"},
+			},
+			auth:        true,
+			wantBaggage: "tenant.id=acme",
+		},
+	}
+
+	for _, mode := range []instrumentation{interceptors, statsHandlers} {
+		for _, tt := range tests {
+			t.Run(mode.String()+"/"+tt.name, func(t *testing.T) {
+				env := startTestEnv(t, mode, grpctrace.WithTrustPolicy(tt.policy))
+
+				tenantID, _ := baggage.NewMember("tenant.id", "acme")
+				secret, _ := baggage.NewMember("secret", "42")
+				bag, _ := baggage.New(tenantID, secret)
+				ctx := baggage.ContextWithBaggage(context.Background(), bag)
+				if tt.auth {
+					ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token")
+				}
+
+				if _, err := env.client.SayHello(ctx, &pb.HelloRequest{Name: "Go Developer"}); err != nil {
+					t.Fatalf("SayHello() error = %v", err)
+				}
+
+				spans := env.waitForSpans(t, 3)
+				client := spans[trace.SpanKindClient.String()]
+				server := spans[trace.SpanKindServer.String()]
+				handler := spans["SayHello"]
+
+				if tt.wantTrusted {
+					if server.Parent().SpanID() != client.SpanContext().SpanID() {
+						t.Errorf("server span parent = %s, want client span %s", server.Parent().SpanID(), client.SpanContext().SpanID())
+					}
+					if len(server.Links()) != 0 {
+						t.Errorf("server span links = %v, want none", server.Links())
+					}
+				} else {
+					if server.Parent().IsValid() {
+						t.Errorf("server span parent = %s, want new root", server.Parent().SpanID())
+					}
+					if server.SpanContext().TraceID() == client.SpanContext().TraceID() {
+						t.Errorf("server span continues untrusted trace %s", client.SpanContext().TraceID())
+					}
+					links := server.Links()
+					if len(links) != 1 || links[0].SpanContext.SpanID() != client.SpanContext().SpanID() {
+						t.Errorf("server span links = %v, want link to client span %s", links, client.SpanContext().SpanID())
+					}
+				}
+
+				var gotBaggage string
+				for _, kv := range handler.Attributes() {
+					if kv.Key == "test.baggage" {
+						gotBaggage = kv.Value.AsString()
+					}
+				}
+				if got, want := sortedBaggage(gotBaggage), sortedBaggage(tt.wantBaggage); got != want {
+					t.Errorf("handler baggage = %q, want %q", gotBaggage, tt.wantBaggage)
+				}
+			})
+		}
+	}
+
+}
+
+func TestParseNetworks(t *testing.T) {
+	got, err := grpctrace.ParseNetworks([]string{"10.1.2.3/8", "192.168.0.1", "::1"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.0.1/32", "::1/128"}
+	for i, prefix := range got {
+		if prefix.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, prefix, want[i])
+		}
+	}
+
+	if _, err := grpctrace.ParseNetworks([]string{"not-an-ip"}); err == nil {
+		t.Error("ParseNetworks() with invalid network returned no error")
+	}
+}
+
+// sortedBaggage приводит строку baggage к виду, не зависящему от порядка ключей
+func sortedBaggage(s string) string {
+	bag, err := baggage.Parse(s)
+	if err != nil {
+		return s
+	}
+	members := bag.Members()
+	keys := make(map[string]string, len(members))
+	for _, m := range members {
+		keys[m.Key()] = m.Value()
+	}
+	var out string
+	for _, key := range []string{"secret", "tenant.id"} {
+		if v, ok := keys[key]; ok {
+			out += key + "=" + v + ";"
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package grpctrace
+
+import (
+	"context"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Wrapper трассирует вызовы в обертках, которые генерирует
+// protoc-gen-go-traced. Обертки обходятся без interceptors, а атрибуты берут
+// из типизированных методов TraceAttributes сообщений вместо protoreflect.
+// Опции (доверие, флаг отладки, часы, политики) действуют так же, как в
+// UnaryServerInterceptor и UnaryClientInterceptor.
+type Wrapper struct {
+	tracer trace.Tracer
+	cfg    *config
+}
+
+// NewWrapper создает Wrapper; вызывается из сгенерированных конструкторов
+// NewTraced*Client и NewTraced*Server
+func NewWrapper(tracer trace.Tracer, opts ...Option) *Wrapper {
+	return &Wrapper{tracer: tracer, cfg: newConfig(opts)}
+}
+
+// StartClientSpan начинает span исходящего вызова fullMethod и добавляет
+// контекст трассировки в исходящие метаданные
+func (w *Wrapper) StartClientSpan(ctx context.Context, fullMethod string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	policy := w.cfg.policies.Lookup(fullMethod)
+	if policy.Disabled {
+		return InjectSpanContext(ctx), noop.Span{}
+	}
+
+	ctx, span := w.tracer.Start(ctx, policy.spanName(fullMethod),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(w.cfg.clock.Now()),
+		trace.WithAttributes(rpcAttributes(fullMethod)...),
+		trace.WithAttributes(attrs...),
+	)
+	if w.cfg.peerName != "" {
+		span.SetAttributes(attribute.String("net.peer.name", w.cfg.peerName))
+	}
+
+	if tenantID := tenant.FromContext(ctx); tenantID != "" {
+		span.SetAttributes(tenant.AttributeKey.String(tenantID))
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, tenantID)
+	}
+
+	return InjectSpanContext(ctx), span
+}
+
+// StartServerSpan начинает span входящего вызова fullMethod, продолжая trace
+// из метаданных клиента, и возвращает trace id в заголовках ответа
+func (w *Wrapper) StartServerSpan(ctx context.Context, fullMethod string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span, _ := w.cfg.startServerSpan(ctx, w.tracer, fullMethod, trace.WithAttributes(attrs...))
+	if span == nil {
+		// Метод отключен политикой: span не пишется
+		return ctx, noop.Span{}
+	}
+
+	// Вне gRPC сервера (например, в тестах обработчика) заголовки ставить некуда
+	_ = grpc.SetHeader(ctx, TraceResponseMetadata(span.SpanContext()))
+
+	return ctx, span
+}
+
+// EndClientSpan записывает результат исходящего вызова fullMethod и
+// завершает span; статус span зависит от политики метода, как в
+// UnaryClientInterceptor. Атрибуты ответа добавляются только при успехе.
+func (w *Wrapper) EndClientSpan(span trace.Span, fullMethod string, err error, attrs ...attribute.KeyValue) {
+	defer func() { span.End(trace.WithTimestamp(w.cfg.clock.Now())) }()
+
+	w.cfg.setClientStatus(span, w.cfg.policies.Lookup(fullMethod), err)
+	if err == nil {
+		span.SetAttributes(attrs...)
+	}
+}
+
+// EndServerSpan записывает результат входящего вызова fullMethod и
+// завершает span, как UnaryServerInterceptor: статус по политике метода, а
+// при ошибке trace id в трейлерах ответа
+func (w *Wrapper) EndServerSpan(ctx context.Context, span trace.Span, fullMethod string, err error, attrs ...attribute.KeyValue) {
+	defer func() { span.End(trace.WithTimestamp(w.cfg.clock.Now())) }()
+
+	w.cfg.setServerStatus(ctx, span, w.cfg.policies.Lookup(fullMethod), err)
+	if err == nil {
+		span.SetAttributes(attrs...)
+	}
+}
+
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	service, _ := splitMethod(fullMethod)
+	return []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", shortService(service)),
+		attribute.String("rpc.method", fullMethod),
+		attribute.String("grpc.type", "unary"),
+	}
+}
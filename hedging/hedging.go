@@ -0,0 +1,248 @@
+// Package hedging сокращает хвост задержек клиентских вызовов: если ответ
+// не пришел за заданное время, тот же запрос отправляется еще раз, и
+// вызывающий получает первый успешный ответ. Каждая попытка — отдельный
+// дочерний span с атрибутами, по которым видно, какая из них выиграла.
+package hedging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Policy задает, сколько попыток отправлять и через какое время
+type Policy struct {
+	// MaxAttempts — наибольшее число одновременных попыток, включая
+	// первую; при 1 и меньше вызовы не дублируются
+	MaxAttempts int
+	// Delay — через сколько после предыдущей попытки отправлять следующую,
+	// если ответа еще нет. Неудачная попытка с кодом из NonFatalCodes
+	// запускает следующую сразу.
+	Delay time.Duration
+	// NonFatalCodes — коды, после которых вызов ждет остальные попытки;
+	// с любым другим кодом вызов сразу завершается этой ошибкой. По
+	// умолчанию — только Unavailable.
+	NonFatalCodes []grpccodes.Code
+}
+
+// Validate проверяет, что политика имеет смысл
+func (p Policy) Validate() error {
+	if p.MaxAttempts > 1 && p.Delay <= 0 {
+		return errors.New("hedging delay must be positive")
+	}
+	return nil
+}
+
+// nonFatal сообщает, можно ли после ошибки err продолжать другие попытки
+func (p Policy) nonFatal(err error) bool {
+	code := status.Code(err)
+	if len(p.NonFatalCodes) == 0 {
+		return code == grpccodes.Unavailable
+	}
+	for _, c := range p.NonFatalCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled сообщает, дублирует ли политика вызовы
+func (p Policy) Enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// result — итог одной попытки
+type result struct {
+	attempt int
+	winner  bool
+	reply   proto.Message
+	err     error
+	header  metadata.MD
+	trailer metadata.MD
+	peer    peer.Peer
+}
+
+// UnaryClientInterceptor отправляет вызов по policy. Весь вызов — span
+// "hedging" с атрибутами hedging.attempts и hedging.winner_attempt, каждая
+// попытка — его дочерний span "hedging.attempt"; span gRPC вызова
+// (interceptor или stats handler из grpctrace) оказывается внутри попытки. Когда одна
+// попытка успешна, остальные отменяются. Сообщения ответа должны быть proto.
+func UnaryClientInterceptor(tracer trace.Tracer, policy Policy) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		replyMsg, ok := reply.(proto.Message)
+		if !policy.Enabled() || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, span := tracer.Start(ctx, "hedging",
+			trace.WithAttributes(
+				attribute.String("rpc.method", method),
+				attribute.Int("hedging.max_attempts", policy.MaxAttempts),
+				attribute.Int64("hedging.delay_ms", policy.Delay.Milliseconds()),
+			),
+		)
+		defer span.End()
+
+		// Отмена ctx останавливает проигравшие попытки
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Победителя выбирают сами попытки: первая успешная записывает свой
+		// номер, и ее span получает hedging.winner=true до завершения
+		var winner atomic.Int32
+		results := make(chan result, policy.MaxAttempts)
+		start := func(attempt int, reason string) {
+			if attempt > 1 {
+				span.AddEvent("hedge started", trace.WithAttributes(
+					attribute.Int("hedging.attempt", attempt),
+					attribute.String("hedging.reason", reason),
+				))
+			}
+			go func() {
+				results <- runAttempt(ctx, tracer, attempt, &winner, method, req, replyMsg, cc, invoker, opts)
+			}()
+		}
+
+		timer := time.NewTimer(policy.Delay)
+		defer timer.Stop()
+
+		started, pending := 1, 1
+		start(1, "")
+		var lastErr error
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				if started < policy.MaxAttempts {
+					started++
+					pending++
+					start(started, "delay")
+					timer.Reset(policy.Delay)
+				}
+				continue
+			case r := <-results:
+				pending--
+				if r.winner {
+					span.SetAttributes(
+						attribute.Int("hedging.attempts", started),
+						attribute.Int("hedging.winner_attempt", r.attempt),
+					)
+					span.SetStatus(codes.Ok, "success")
+					copyResult(r, replyMsg, opts)
+					return nil
+				}
+				// Успешная попытка, которая опоздала: результат победителя
+				// еще в пути
+				if r.err == nil {
+					continue
+				}
+				lastErr = r.err
+				// Ошибка отмены вызывающим не повод для новой попытки
+				if ctx.Err() != nil {
+					continue
+				}
+				// Повтор не исправит, например, InvalidArgument: такой ответ
+				// сервера окончательный, остальные попытки отменяются
+				if !policy.nonFatal(r.err) {
+					span.SetAttributes(attribute.Int("hedging.attempts", started))
+					span.SetStatus(codes.Error, r.err.Error())
+					copyResult(r, replyMsg, opts)
+					return r.err
+				}
+				// Неудачная попытка не ждет задержки
+				if started < policy.MaxAttempts {
+					started++
+					pending++
+					start(started, "failure")
+					timer.Reset(policy.Delay)
+				}
+			}
+		}
+
+		span.SetAttributes(attribute.Int("hedging.attempts", started))
+		span.SetStatus(codes.Error, lastErr.Error())
+		return lastErr
+	}
+}
+
+// runAttempt выполняет одну попытку в своем span. Ответ, заголовки и
+// трейлеры пишутся в собственные переменные попытки: попытки идут
+// одновременно, и вызывающий получит данные только победителя.
+func runAttempt(ctx context.Context, tracer trace.Tracer, attempt int, winner *atomic.Int32, method string, req interface{}, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) result {
+	ctx, span := tracer.Start(ctx, "hedging.attempt",
+		trace.WithAttributes(attribute.Int("hedging.attempt", attempt)),
+	)
+	defer span.End()
+
+	r := result{attempt: attempt, reply: reply.ProtoReflect().New().Interface()}
+	attemptOpts := make([]grpc.CallOption, 0, len(opts)+3)
+	for _, opt := range opts {
+		switch opt.(type) {
+		case grpc.HeaderCallOption, grpc.TrailerCallOption, grpc.PeerCallOption:
+			// Заменяются собственными переменными попытки
+		default:
+			attemptOpts = append(attemptOpts, opt)
+		}
+	}
+	attemptOpts = append(attemptOpts, grpc.Header(&r.header), grpc.Trailer(&r.trailer), grpc.Peer(&r.peer))
+
+	r.err = invoker(ctx, method, req, r.reply, cc, attemptOpts...)
+	switch {
+	case r.err == nil:
+		r.winner = winner.CompareAndSwap(0, int32(attempt))
+		span.SetStatus(codes.Ok, "success")
+	case status.Code(r.err) == grpccodes.Canceled && ctx.Err() != nil:
+		span.SetAttributes(attribute.Bool("hedging.cancelled", true))
+	default:
+		span.SetStatus(codes.Error, r.err.Error())
+		span.RecordError(r.err)
+	}
+	span.SetAttributes(attribute.Bool("hedging.winner", r.winner))
+	return r
+}
+
+// copyResult передает вызывающему ответ, заголовки, трейлеры и адрес
+// завершившей вызов попытки; ответ — только успешной
+func copyResult(r result, reply proto.Message, opts []grpc.CallOption) {
+	if r.err == nil {
+		proto.Reset(reply)
+		proto.Merge(reply, r.reply)
+	}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = r.header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = r.trailer
+		case grpc.PeerCallOption:
+			*o.PeerAddr = r.peer
+		}
+	}
+}
+
+// String описывает политику для логов
+func (p Policy) String() string {
+	if !p.Enabled() {
+		return "disabled"
+	}
+	return fmt.Sprintf("max_attempts=%d delay=%s", p.MaxAttempts, p.Delay)
+}
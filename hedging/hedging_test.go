@@ -0,0 +1,278 @@
+package hedging_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/hedging"
+	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// greeter отвечает на n-й запрос по behave(n) и возвращает номер запроса в
+// заголовке x-request
+type greeter struct {
+	pb.UnimplementedGreeterServer
+	calls  atomic.Int32
+	behave func(ctx context.Context, n int) error
+}
+
+func (g *greeter) SayHello(ctx context.Context, _ *pb.HelloRequest) (*pb.HelloResponse, error) {
+	n := int(g.calls.Add(1))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request", strconv.Itoa(n)))
+	if err := g.behave(ctx, n); err != nil {
+		return nil, err
+	}
+	return &pb.HelloResponse{Message: "reply " + strconv.Itoa(n)}, nil
+}
+
+// blockFirst держит первый запрос до отмены, остальные отвечают сразу
+func blockFirst(ctx context.Context, n int) error {
+	if n == 1 {
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return nil
+}
+
+func start(t *testing.T, behave func(context.Context, int) error, policy hedging.Policy) (pb.GreeterClient, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterGreeterServer(srv, &greeter{behave: behave})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithUnaryInterceptor(hedging.UnaryClientInterceptor(tp.Tracer("test"), policy)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewGreeterClient(conn), recorder
+}
+
+// waitForSpans ждет n завершенных span: отмененные попытки заканчиваются
+// после возврата вызова
+func waitForSpans(t *testing.T, recorder *tracetest.SpanRecorder, n int) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Ended()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d ended spans, want %d", len(recorder.Ended()), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return recorder.Ended()
+}
+
+func attrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+// attempts возвращает атрибуты span попыток по номеру попытки и атрибуты
+// span всего вызова
+func attempts(t *testing.T, spans []sdktrace.ReadOnlySpan) (map[int64]map[attribute.Key]attribute.Value, map[attribute.Key]attribute.Value) {
+	t.Helper()
+	var parent sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == "hedging" {
+			parent = s
+		}
+	}
+	if parent == nil {
+		t.Fatal("no hedging span")
+	}
+	byAttempt := make(map[int64]map[attribute.Key]attribute.Value)
+	for _, s := range spans {
+		if s.Name() != "hedging.attempt" {
+			continue
+		}
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("attempt span parent = %s, want %s", s.Parent().SpanID(), parent.SpanContext().SpanID())
+		}
+		a := attrs(s)
+		byAttempt[a["hedging.attempt"].AsInt64()] = a
+	}
+	return byAttempt, attrs(parent)
+}
+
+func TestHedgeWinsAfterDelay(t *testing.T) {
+	client, recorder := start(t, blockFirst, hedging.Policy{MaxAttempts: 2, Delay: 20 * time.Millisecond})
+
+	var header metadata.MD
+	resp, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "test"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+
+	// Ответ и заголовки — от второй попытки
+	if resp.Message != "reply 2" {
+		t.Errorf("response = %q, want reply 2", resp.Message)
+	}
+	if got := header.Get("x-request"); len(got) != 1 || got[0] != "2" {
+		t.Errorf("x-request header = %v, want [2]", got)
+	}
+
+	byAttempt, call := attempts(t, waitForSpans(t, recorder, 3))
+	if got := call["hedging.winner_attempt"].AsInt64(); got != 2 {
+		t.Errorf("hedging.winner_attempt = %d, want 2", got)
+	}
+	if got := call["hedging.attempts"].AsInt64(); got != 2 {
+		t.Errorf("hedging.attempts = %d, want 2", got)
+	}
+	if a := byAttempt[1]; a["hedging.winner"].AsBool() || !a["hedging.cancelled"].AsBool() {
+		t.Errorf("attempt 1 attributes = %v, want cancelled loser", a)
+	}
+	if a := byAttempt[2]; !a["hedging.winner"].AsBool() {
+		t.Errorf("attempt 2 attributes = %v, want winner", a)
+	}
+}
+
+func TestFailedAttemptStartsHedgeImmediately(t *testing.T) {
+	failFirst := func(_ context.Context, n int) error {
+		if n == 1 {
+			return status.Error(codes.Unavailable, "overloaded")
+		}
+		return nil
+	}
+	// С такой задержкой вторая попытка возможна только после ошибки первой
+	client, recorder := start(t, failFirst, hedging.Policy{MaxAttempts: 2, Delay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: "test"})
+	if err != nil {
+		t.Fatalf("SayHello: %v", err)
+	}
+	if resp.Message != "reply 2" {
+		t.Errorf("response = %q, want reply 2", resp.Message)
+	}
+
+	byAttempt, call := attempts(t, waitForSpans(t, recorder, 3))
+	if got := call["hedging.winner_attempt"].AsInt64(); got != 2 {
+		t.Errorf("hedging.winner_attempt = %d, want 2", got)
+	}
+	if a := byAttempt[1]; a["hedging.winner"].AsBool() || a["hedging.cancelled"].AsBool() {
+		t.Errorf("attempt 1 attributes = %v, want failed loser", a)
+	}
+}
+
+func TestAllAttemptsFail(t *testing.T) {
+	fail := func(context.Context, int) error {
+		return status.Error(codes.Unavailable, "overloaded")
+	}
+	client, recorder := start(t, fail, hedging.Policy{MaxAttempts: 3, Delay: time.Hour})
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "test"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("SayHello error = %v, want Unavailable", err)
+	}
+
+	byAttempt, call := attempts(t, waitForSpans(t, recorder, 4))
+	if len(byAttempt) != 3 {
+		t.Errorf("got %d attempt spans, want 3", len(byAttempt))
+	}
+	if got := call["hedging.attempts"].AsInt64(); got != 3 {
+		t.Errorf("hedging.attempts = %d, want 3", got)
+	}
+	if _, ok := call["hedging.winner_attempt"]; ok {
+		t.Errorf("unexpected hedging.winner_attempt on failed call: %v", call)
+	}
+}
+
+func TestFatalErrorEndsCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		nonFatal []codes.Code
+		// wantCode — ошибка вызова, wantCalls — сколько попыток дошло до сервера
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{name: "default codes", wantCode: codes.InvalidArgument, wantCalls: 1},
+		{name: "custom codes", nonFatal: []codes.Code{codes.InvalidArgument}, wantCode: codes.OK, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			invalidFirst := func(_ context.Context, n int) error {
+				calls.Add(1)
+				if n == 1 {
+					return status.Error(codes.InvalidArgument, "bad name")
+				}
+				return nil
+			}
+			client, recorder := start(t, invalidFirst, hedging.Policy{MaxAttempts: 3, Delay: time.Hour, NonFatalCodes: tt.nonFatal})
+
+			var header metadata.MD
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "test"}, grpc.Header(&header))
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("SayHello error = %v, want %v", err, tt.wantCode)
+			}
+			if got := int(calls.Load()); got != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", got, tt.wantCalls)
+			}
+			// Заголовки — от попытки, завершившей вызов
+			if got := header.Get("x-request"); len(got) != 1 || got[0] != strconv.Itoa(tt.wantCalls) {
+				t.Errorf("x-request header = %v, want [%d]", got, tt.wantCalls)
+			}
+
+			_, call := attempts(t, waitForSpans(t, recorder, tt.wantCalls+1))
+			if got := call["hedging.attempts"].AsInt64(); got != int64(tt.wantCalls) {
+				t.Errorf("hedging.attempts = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDisabledPolicy(t *testing.T) {
+	client, recorder := start(t, blockFirst, hedging.Policy{MaxAttempts: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "test"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("SayHello error = %v, want DeadlineExceeded", err)
+	}
+	if n := len(recorder.Ended()); n != 0 {
+		t.Errorf("got %d spans without hedging, want 0", n)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := (hedging.Policy{MaxAttempts: 2}).Validate(); err == nil {
+		t.Error("Validate() with zero delay succeeded, want error")
+	}
+	if err := (hedging.Policy{MaxAttempts: 1}).Validate(); err != nil {
+		t.Errorf("Validate() of disabled policy: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Code generated by protoc-gen-go-traced. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-traced v1.0.0
+// - protoc             v4.25.8
+// source: proto/hello.proto
+
+package hello
+
+import (
+	context "context"
+	grpctrace "github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	attribute "go.opentelemetry.io/otel/attribute"
+	trace "go.opentelemetry.io/otel/trace"
+	grpc "google.golang.org/grpc"
+)
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *HelloRequest) TraceAttributes() []attribute.KeyValue {
+	if x == nil {
+		return nil
+	}
+	var attrs []attribute.KeyValue
+	if x.GetName() != "" {
+		attrs = append(attrs, attribute.String("greeter.name", x.GetName()))
+	}
+	return attrs
+}
+
+// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)
+func (x *HelloResponse) TraceAttributes() []attribute.KeyValue {
+	return nil
+}
+
+type tracedGreeterClient struct {
+	GreeterClient
+	w *grpctrace.Wrapper
+}
+
+// NewTracedGreeterClient оборачивает клиент так, что каждый unary вызов
+// создает span и передает контекст трассировки серверу. Потоковые методы
+// вызываются без изменений.
+func NewTracedGreeterClient(c GreeterClient, tracer trace.Tracer, opts ...grpctrace.Option) GreeterClient {
+	return &tracedGreeterClient{GreeterClient: c, w: grpctrace.NewWrapper(tracer, opts...)}
+}
+
+func (c *tracedGreeterClient) SayHello(ctx context.Context, in *HelloRequest, opts ...grpc.CallOption) (*HelloResponse, error) {
+	ctx, span := c.w.StartClientSpan(ctx, Greeter_SayHello_FullMethodName, in.TraceAttributes()...)
+	out, err := c.GreeterClient.SayHello(ctx, in, opts...)
+	c.w.EndClientSpan(span, Greeter_SayHello_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
+
+type tracedGreeterServer struct {
+	GreeterServer
+	w *grpctrace.Wrapper
+}
+
+// NewTracedGreeterServer оборачивает реализацию сервиса так, что каждый
+// unary вызов создает span, продолжающий trace клиента. Опции те же, что у
+// серверного interceptor: доверие, флаг отладки, часы и политики методов.
+// Потоковые методы вызываются без изменений.
+func NewTracedGreeterServer(s GreeterServer, tracer trace.Tracer, opts ...grpctrace.Option) GreeterServer {
+	return &tracedGreeterServer{GreeterServer: s, w: grpctrace.NewWrapper(tracer, opts...)}
+}
+
+func (s *tracedGreeterServer) SayHello(ctx context.Context, in *HelloRequest) (*HelloResponse, error) {
+	ctx, span := s.w.StartServerSpan(ctx, Greeter_SayHello_FullMethodName, in.TraceAttributes()...)
+	out, err := s.GreeterServer.SayHello(ctx, in)
+	s.w.EndServerSpan(ctx, span, Greeter_SayHello_FullMethodName, err, out.TraceAttributes()...)
+	return out, err
+}
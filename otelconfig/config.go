@@ -0,0 +1,444 @@
+// Package otelconfig читает файл декларативной конфигурации OpenTelemetry
+// (YAML, file_format 0.3) и строит по нему настройки TracerProvider:
+// ресурс, процессоры с экспортерами, семплер, лимиты и propagator.
+// Поддерживается та часть схемы, которая нужна примерам; неизвестные ключи
+// считаются ошибкой, чтобы опечатка не отключала настройку молча.
+package otelconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SupportedFileFormat — версия схемы, которую понимает пакет
+const SupportedFileFormat = "0.3"
+
+// Config — корень файла конфигурации
+type Config struct {
+	FileFormat     string          `yaml:"file_format"`
+	Disabled       bool            `yaml:"disabled"`
+	Resource       *Resource       `yaml:"resource"`
+	Propagator     *Propagator     `yaml:"propagator"`
+	TracerProvider *TracerProvider `yaml:"tracer_provider"`
+}
+
+// Resource описывает атрибуты ресурса
+type Resource struct {
+	SchemaURL  string               `yaml:"schema_url"`
+	Attributes []AttributeNameValue `yaml:"attributes"`
+}
+
+// AttributeNameValue — атрибут с явным типом: string (по умолчанию), bool,
+// int, double, string_array, bool_array, int_array или double_array
+type AttributeNameValue struct {
+	Name  string      `yaml:"name"`
+	Value interface{} `yaml:"value"`
+	Type  string      `yaml:"type"`
+}
+
+// Propagator перечисляет propagators: tracecontext, baggage, grpc-trace-bin
+type Propagator struct {
+	Composite []string `yaml:"composite"`
+}
+
+// TracerProvider описывает процессоры, семплер и лимиты span
+type TracerProvider struct {
+	Processors []SpanProcessor `yaml:"processors"`
+	Sampler    *Sampler        `yaml:"sampler"`
+	Limits     *SpanLimits     `yaml:"limits"`
+}
+
+// SpanProcessor — ровно один из batch или simple
+type SpanProcessor struct {
+	Batch  *BatchSpanProcessor  `yaml:"batch"`
+	Simple *SimpleSpanProcessor `yaml:"simple"`
+}
+
+// BatchSpanProcessor — пакетная отправка; интервалы в миллисекундах
+type BatchSpanProcessor struct {
+	ScheduleDelay      *int         `yaml:"schedule_delay"`
+	ExportTimeout      *int         `yaml:"export_timeout"`
+	MaxQueueSize       *int         `yaml:"max_queue_size"`
+	MaxExportBatchSize *int         `yaml:"max_export_batch_size"`
+	Exporter           SpanExporter `yaml:"exporter"`
+}
+
+// SimpleSpanProcessor отправляет каждый span сразу после завершения
+type SimpleSpanProcessor struct {
+	Exporter SpanExporter `yaml:"exporter"`
+}
+
+// SpanExporter — ровно один из otlp или console
+type SpanExporter struct {
+	OTLP    *OTLP     `yaml:"otlp"`
+	Console *struct{} `yaml:"console"`
+}
+
+// OTLP — экспортер OTLP по HTTP (http/protobuf) или gRPC (grpc)
+type OTLP struct {
+	Protocol    string      `yaml:"protocol"`
+	Endpoint    string      `yaml:"endpoint"`
+	Headers     []NameValue `yaml:"headers"`
+	Compression string      `yaml:"compression"`
+	// Timeout — таймаут экспорта в миллисекундах
+	Timeout  *int `yaml:"timeout"`
+	Insecure bool `yaml:"insecure"`
+}
+
+// NameValue — заголовок экспортера
+type NameValue struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Sampler — ровно один из вариантов
+type Sampler struct {
+	AlwaysOn          *struct{}           `yaml:"always_on"`
+	AlwaysOff         *struct{}           `yaml:"always_off"`
+	TraceIDRatioBased *TraceIDRatioBased  `yaml:"trace_id_ratio_based"`
+	ParentBased       *ParentBasedSampler `yaml:"parent_based"`
+}
+
+// TraceIDRatioBased семплирует долю ratio от 0 до 1
+type TraceIDRatioBased struct {
+	Ratio *float64 `yaml:"ratio"`
+}
+
+// ParentBasedSampler следует решению родителя, для корней использует Root
+type ParentBasedSampler struct {
+	Root                   *Sampler `yaml:"root"`
+	RemoteParentSampled    *Sampler `yaml:"remote_parent_sampled"`
+	RemoteParentNotSampled *Sampler `yaml:"remote_parent_not_sampled"`
+	LocalParentSampled     *Sampler `yaml:"local_parent_sampled"`
+	LocalParentNotSampled  *Sampler `yaml:"local_parent_not_sampled"`
+}
+
+// SpanLimits ограничивает число и размер атрибутов, событий и ссылок
+type SpanLimits struct {
+	AttributeValueLengthLimit *int `yaml:"attribute_value_length_limit"`
+	AttributeCountLimit       *int `yaml:"attribute_count_limit"`
+	EventCountLimit           *int `yaml:"event_count_limit"`
+	LinkCountLimit            *int `yaml:"link_count_limit"`
+	EventAttributeCountLimit  *int `yaml:"event_attribute_count_limit"`
+	LinkAttributeCountLimit   *int `yaml:"link_attribute_count_limit"`
+}
+
+// UnmarshalYAML считает console заданным и при пустом значении: в файлах
+// его обычно пишут голым ключом "console:", который yaml декодирует в nil
+func (e *SpanExporter) UnmarshalYAML(node *yaml.Node) error {
+	type plain SpanExporter
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+	setIfPresent(node, "console", &e.Console)
+	return nil
+}
+
+// UnmarshalYAML считает always_on и always_off заданными и при пустом
+// значении, как в примерах схемы
+func (s *Sampler) UnmarshalYAML(node *yaml.Node) error {
+	type plain Sampler
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	setIfPresent(node, "always_on", &s.AlwaysOn)
+	setIfPresent(node, "always_off", &s.AlwaysOff)
+	return nil
+}
+
+// setIfPresent заполняет *field, если ключ key есть в отображении node
+func setIfPresent(node *yaml.Node, key string, field **struct{}) {
+	if node.Kind != yaml.MappingNode || *field != nil {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			*field = &struct{}{}
+			return
+		}
+	}
+}
+
+// Load читает и проверяет файл конфигурации
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("otelconfig: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("otelconfig: %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse разбирает и проверяет конфигурацию. Переменные окружения ${NAME} и
+// ${NAME:-default} подставляются в скалярные значения уже разобранного
+// документа, поэтому значение переменной не может изменить его структуру.
+func Parse(data []byte) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	// Node.Decode не умеет KnownFields, поэтому неизвестные ключи ищем сами
+	if errs := unknownFields(&doc, reflect.TypeOf(Config{})); len(errs) > 0 {
+		return nil, &yaml.TypeError{Errors: errs}
+	}
+	substituteEnv(&doc)
+
+	var cfg Config
+	if err := doc.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// unknownFields возвращает ошибки для ключей node, которых нет в типе t, в
+// том же виде, что и yaml.Decoder с KnownFields
+func unknownFields(node *yaml.Node, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var errs []string
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			errs = append(errs, unknownFields(child, t)...)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice {
+			for _, child := range node.Content {
+				errs = append(errs, unknownFields(child, t.Elem())...)
+			}
+		}
+	case yaml.MappingNode:
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fieldByTag(t, key.Value)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+				continue
+			}
+			errs = append(errs, unknownFields(node.Content[i+1], field.Type)...)
+		}
+	}
+	return errs
+}
+
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); tag == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// substituteEnv подставляет переменные окружения в скалярные значения node;
+// ключи не меняются. Как в спецификации, незаданная переменная без значения
+// по умолчанию становится пустой строкой, а тип значения без кавычек
+// определяется по результату подстановки.
+func substituteEnv(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value := envRef.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			m := envRef.FindStringSubmatch(ref)
+			if value, ok := os.LookupEnv(m[1]); ok && value != "" {
+				return value
+			}
+			return m[3]
+		})
+		if value == node.Value {
+			return
+		}
+		node.Value = value
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+	case yaml.MappingNode:
+		// Content чередует ключи и значения
+		for i := 1; i < len(node.Content); i += 2 {
+			substituteEnv(node.Content[i])
+		}
+	default:
+		for _, child := range node.Content {
+			substituteEnv(child)
+		}
+	}
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу,
+// каждую с путем к полю
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if c.FileFormat == "" {
+		add("file_format", "is required")
+	} else if c.FileFormat != SupportedFileFormat {
+		add("file_format", "unsupported version %q, want %q", c.FileFormat, SupportedFileFormat)
+	}
+
+	if c.Resource != nil {
+		for i, attr := range c.Resource.Attributes {
+			path := fmt.Sprintf("resource.attributes[%d]", i)
+			if attr.Name == "" {
+				add(path+".name", "is required")
+			}
+			if _, err := attr.keyValue(); err != nil {
+				add(path, "%v", err)
+			}
+		}
+	}
+
+	if c.Propagator != nil {
+		for i, name := range c.Propagator.Composite {
+			switch name {
+			case "tracecontext", "baggage", "grpc-trace-bin", "none":
+			default:
+				add(fmt.Sprintf("propagator.composite[%d]", i), "unknown propagator %q", name)
+			}
+		}
+	}
+
+	if tp := c.TracerProvider; tp != nil {
+		for i, p := range tp.Processors {
+			path := fmt.Sprintf("tracer_provider.processors[%d]", i)
+			switch {
+			case p.Batch != nil && p.Simple != nil, p.Batch == nil && p.Simple == nil:
+				add(path, "exactly one of batch or simple must be set")
+			case p.Batch != nil:
+				b := p.Batch
+				for _, f := range []intField{
+					{"schedule_delay", b.ScheduleDelay},
+					{"export_timeout", b.ExportTimeout},
+					{"max_queue_size", b.MaxQueueSize},
+					{"max_export_batch_size", b.MaxExportBatchSize},
+				} {
+					if f.value != nil && *f.value <= 0 {
+						add(path+".batch."+f.name, "must be positive, got %d", *f.value)
+					}
+				}
+				if b.MaxQueueSize != nil && b.MaxExportBatchSize != nil && *b.MaxExportBatchSize > *b.MaxQueueSize {
+					add(path+".batch.max_export_batch_size", "must not exceed max_queue_size")
+				}
+				errs = append(errs, b.Exporter.validate(path+".batch.exporter")...)
+			case p.Simple != nil:
+				errs = append(errs, p.Simple.Exporter.validate(path+".simple.exporter")...)
+			}
+		}
+		if tp.Sampler != nil {
+			errs = append(errs, tp.Sampler.validate("tracer_provider.sampler")...)
+		}
+		if l := tp.Limits; l != nil {
+			for _, f := range []intField{
+				{"attribute_value_length_limit", l.AttributeValueLengthLimit},
+				{"attribute_count_limit", l.AttributeCountLimit},
+				{"event_count_limit", l.EventCountLimit},
+				{"link_count_limit", l.LinkCountLimit},
+				{"event_attribute_count_limit", l.EventAttributeCountLimit},
+				{"link_attribute_count_limit", l.LinkAttributeCountLimit},
+			} {
+				if f.value != nil && *f.value < 0 {
+					add("tracer_provider.limits."+f.name, "must not be negative, got %d", *f.value)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// intField — числовое поле с именем для проверок по порядку объявления
+type intField struct {
+	name  string
+	value *int
+}
+
+func (e SpanExporter) validate(path string) []error {
+	switch {
+	case e.OTLP != nil && e.Console != nil, e.OTLP == nil && e.Console == nil:
+		return []error{fmt.Errorf("%s: exactly one of otlp or console must be set", path)}
+	case e.OTLP != nil:
+		var errs []error
+		switch e.OTLP.Protocol {
+		case "http/protobuf", "grpc":
+		case "":
+			errs = append(errs, fmt.Errorf("%s.otlp.protocol: is required (http/protobuf or grpc)", path))
+		default:
+			errs = append(errs, fmt.Errorf("%s.otlp.protocol: unsupported protocol %q, want http/protobuf or grpc", path, e.OTLP.Protocol))
+		}
+		switch e.OTLP.Compression {
+		case "", "none", "gzip":
+		default:
+			errs = append(errs, fmt.Errorf("%s.otlp.compression: unsupported compression %q", path, e.OTLP.Compression))
+		}
+		if e.OTLP.Timeout != nil && *e.OTLP.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s.otlp.timeout: must be positive, got %d", path, *e.OTLP.Timeout))
+		}
+		return errs
+	}
+	return nil
+}
+
+func (s *Sampler) validate(path string) []error {
+	set := 0
+	for _, ok := range []bool{s.AlwaysOn != nil, s.AlwaysOff != nil, s.TraceIDRatioBased != nil, s.ParentBased != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return []error{fmt.Errorf("%s: exactly one of always_on, always_off, trace_id_ratio_based or parent_based must be set", path)}
+	}
+
+	var errs []error
+	if r := s.TraceIDRatioBased; r != nil {
+		if r.Ratio == nil {
+			errs = append(errs, fmt.Errorf("%s.trace_id_ratio_based.ratio: is required", path))
+		} else if *r.Ratio < 0 || *r.Ratio > 1 {
+			errs = append(errs, fmt.Errorf("%s.trace_id_ratio_based.ratio: must be between 0 and 1, got %v", path, *r.Ratio))
+		}
+	}
+	if pb := s.ParentBased; pb != nil {
+		for _, child := range pb.children() {
+			if child.sampler != nil {
+				errs = append(errs, child.sampler.validate(path+".parent_based."+child.name)...)
+			}
+		}
+	}
+	return errs
+}
+
+type namedSampler struct {
+	name    string
+	sampler *Sampler
+}
+
+func (pb *ParentBasedSampler) children() []namedSampler {
+	return []namedSampler{
+		{"root", pb.Root},
+		{"remote_parent_sampled", pb.RemoteParentSampled},
+		{"remote_parent_not_sampled", pb.RemoteParentNotSampled},
+		{"local_parent_sampled", pb.LocalParentSampled},
+		{"local_parent_not_sampled", pb.LocalParentNotSampled},
+	}
+}
@@ -0,0 +1,292 @@
+package otelconfig
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("DEPLOYMENT_ENV", "staging")
+	t.Setenv("OTLP_API_KEY", "secret")
+
+	cfg, err := Load("testdata/otel.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := cfg.TracerProvider.Processors[0].Batch.Exporter.OTLP.Headers[0].Value; got != "secret" {
+		t.Errorf("header value = %q, want value from OTLP_API_KEY", got)
+	}
+
+	opts, err := cfg.TracerProviderOptions(resource.NewSchemaless(attribute.String("service.name", "test")))
+	if err != nil {
+		t.Fatalf("TracerProviderOptions() error = %v", err)
+	}
+	processors, err := cfg.SpanProcessors(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("SpanProcessors() error = %v", err)
+	}
+	if len(processors) != 2 {
+		t.Errorf("got %d processors, want 2", len(processors))
+	}
+	for _, p := range processors {
+		opts = append(opts, sdktrace.WithSpanProcessor(p))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	if got := cfg.TracerProvider.Sampler.build().Description(); !strings.Contains(got, "TraceIDRatioBased{0.5}") {
+		t.Errorf("sampler = %s, want parent based with ratio 0.5", got)
+	}
+
+	propagator, ok, err := cfg.TextMapPropagator()
+	if err != nil || !ok {
+		t.Fatalf("TextMapPropagator() = %v, %v", ok, err)
+	}
+	if got := strings.Join(propagator.Fields(), ","); !strings.Contains(got, "grpc-trace-bin") || !strings.Contains(got, "traceparent") {
+		t.Errorf("propagator fields = %s", got)
+	}
+}
+
+func TestResourceAttributes(t *testing.T) {
+	cfg, err := Parse([]byte(`
+file_format: "0.3"
+resource:
+  attributes:
+    - {name: service.name, value: from-file}
+    - {name: enabled, value: true, type: bool}
+    - {name: ratio, value: 1, type: double}
+    - {name: tags, value: [a, b], type: string_array}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	base := resource.NewSchemaless(attribute.String("service.name", "default"), attribute.String("host.name", "h"))
+	res, err := cfg.BuildResource(base)
+	if err != nil {
+		t.Fatalf("BuildResource() error = %v", err)
+	}
+
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range res.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	if v := got["service.name"].AsString(); v != "from-file" {
+		t.Errorf("service.name = %q, want value from file", v)
+	}
+	if v := got["host.name"].AsString(); v != "h" {
+		t.Errorf("host.name = %q, want value from base resource", v)
+	}
+	if v := got["enabled"]; v.Type() != attribute.BOOL || !v.AsBool() {
+		t.Errorf("enabled = %v, want bool true", v.Emit())
+	}
+	if v := got["ratio"]; v.Type() != attribute.FLOAT64 || v.AsFloat64() != 1 {
+		t.Errorf("ratio = %v, want double 1", v.Emit())
+	}
+	if v := got["tags"].AsStringSlice(); len(v) != 2 || v[1] != "b" {
+		t.Errorf("tags = %v, want [a b]", v)
+	}
+}
+
+func TestBareKeys(t *testing.T) {
+	cfg, err := Parse([]byte(`
+file_format: "0.3"
+tracer_provider:
+  processors:
+    - simple:
+        exporter:
+          console:
+  sampler:
+    parent_based:
+      root:
+        always_on:
+      remote_parent_not_sampled:
+        always_off:`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tp := cfg.TracerProvider
+	if tp.Processors[0].Simple.Exporter.Console == nil {
+		t.Error("bare console: key is not set")
+	}
+	if tp.Sampler.ParentBased.Root.AlwaysOn == nil {
+		t.Error("bare always_on: key is not set")
+	}
+	if tp.Sampler.ParentBased.RemoteParentNotSampled.AlwaysOff == nil {
+		t.Error("bare always_off: key is not set")
+	}
+	if got := tp.Sampler.build().Description(); !strings.Contains(got, "root:AlwaysOnSampler") || !strings.Contains(got, "remoteParentNotSampled:AlwaysOffSampler") {
+		t.Errorf("sampler = %s, want always_on root and always_off for unsampled remote parents", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr []string
+	}{
+		{
+			name:    "missing file format",
+			config:  `disabled: false`,
+			wantErr: []string{"file_format: is required"},
+		},
+		{
+			name:    "unsupported file format",
+			config:  `file_format: "9.9"`,
+			wantErr: []string{`file_format: unsupported version "9.9"`},
+		},
+		{
+			name: "unknown key",
+			config: `
+file_format: "0.3"
+tracer_provider:
+  procesors: []`,
+			wantErr: []string{"line 4", "procesors"},
+		},
+		{
+			name: "invalid processors and sampler",
+			config: `
+file_format: "0.3"
+tracer_provider:
+  processors:
+    - batch:
+        max_queue_size: 10
+        max_export_batch_size: 20
+        exporter:
+          otlp:
+            protocol: http/json
+    - {}
+  sampler:
+    trace_id_ratio_based:
+      ratio: 1.5`,
+			wantErr: []string{
+				"tracer_provider.processors[0].batch.max_export_batch_size: must not exceed max_queue_size",
+				`tracer_provider.processors[0].batch.exporter.otlp.protocol: unsupported protocol "http/json"`,
+				"tracer_provider.processors[1]: exactly one of batch or simple must be set",
+				"tracer_provider.sampler.trace_id_ratio_based.ratio: must be between 0 and 1, got 1.5",
+			},
+		},
+		{
+			name: "bare keys count as set",
+			config: `
+file_format: "0.3"
+tracer_provider:
+  processors:
+    - simple:
+        exporter:
+          console:
+          otlp: {}
+  sampler:
+    always_on:
+    always_off:`,
+			wantErr: []string{
+				"tracer_provider.processors[0].simple.exporter: exactly one of otlp or console must be set",
+				"tracer_provider.sampler: exactly one of",
+			},
+		},
+		{
+			name: "invalid resource and propagator",
+			config: `
+file_format: "0.3"
+resource:
+  attributes:
+    - {name: port, value: abc, type: int}
+propagator:
+  composite: [b3]`,
+			wantErr: []string{
+				`resource.attributes[0]: attribute "port": value abc is not of type int`,
+				`propagator.composite[0]: unknown propagator "b3"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			if err == nil {
+				t.Fatal("Parse() returned no error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	cfg, err := Parse([]byte(`
+file_format: "0.3"
+disabled: true
+tracer_provider:
+  processors:
+    - simple:
+        exporter:
+          console: {}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	processors, err := cfg.SpanProcessors(context.Background(), nil)
+	if err != nil || len(processors) != 0 {
+		t.Errorf("SpanProcessors() = %d processors, %v; want none", len(processors), err)
+	}
+}
+
+func TestSubstituteEnv(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "checkout\nfile_format: \"9.9\"")
+	t.Setenv("HEADER_VALUE", "a: b")
+	t.Setenv("MAX_QUEUE", "64")
+
+	cfg, err := Parse([]byte(`
+file_format: "0.3"
+resource:
+  attributes:
+    - name: service.name
+      value: "${SERVICE_NAME}"
+    - name: deployment.environment
+      value: ${UNSET_VAR:-fallback}
+tracer_provider:
+  processors:
+    - batch:
+        max_queue_size: ${MAX_QUEUE}
+        exporter:
+          otlp:
+            protocol: http/protobuf
+            endpoint: http://localhost:4318
+            headers:
+              - name: x-value
+                value: ${HEADER_VALUE}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// Перевод строки в значении не добавляет в документ новый ключ
+	if cfg.FileFormat != "0.3" {
+		t.Errorf("file_format = %q, want 0.3", cfg.FileFormat)
+	}
+	attrs := cfg.Resource.Attributes
+	if got := attrs[0].Value; got != "checkout\nfile_format: \"9.9\"" {
+		t.Errorf("service.name = %q, want the variable value as is", got)
+	}
+	if got := attrs[1].Value; got != "fallback" {
+		t.Errorf("deployment.environment = %v, want default value fallback", got)
+	}
+	batch := cfg.TracerProvider.Processors[0].Batch
+	if batch.MaxQueueSize == nil || *batch.MaxQueueSize != 64 {
+		t.Errorf("max_queue_size = %v, want 64", batch.MaxQueueSize)
+	}
+	if got := batch.Exporter.OTLP.Headers[0].Value; got != "a: b" {
+		t.Errorf("header value = %q, want %q", got, "a: b")
+	}
+}
@@ -0,0 +1,310 @@
+package otelconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ExporterWrapper оборачивает каждый созданный экспортер, например чтобы
+// добавить метрики экспорта или буфер на диске
+type ExporterWrapper func(sdktrace.SpanExporter) (sdktrace.SpanExporter, error)
+
+// SpanProcessors создает процессоры и экспортеры из tracer_provider.processors.
+// При disabled: true процессоров нет.
+func (c *Config) SpanProcessors(ctx context.Context, wrap ExporterWrapper) ([]sdktrace.SpanProcessor, error) {
+	if c.Disabled || c.TracerProvider == nil {
+		return nil, nil
+	}
+
+	var processors []sdktrace.SpanProcessor
+	for i, p := range c.TracerProvider.Processors {
+		path := fmt.Sprintf("tracer_provider.processors[%d]", i)
+
+		var spec SpanExporter
+		if p.Batch != nil {
+			spec = p.Batch.Exporter
+		} else {
+			spec = p.Simple.Exporter
+		}
+		exporter, err := spec.newExporter(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if wrap != nil {
+			if exporter, err = wrap(exporter); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+
+		if p.Simple != nil {
+			processors = append(processors, sdktrace.NewSimpleSpanProcessor(exporter))
+			continue
+		}
+		var opts []sdktrace.BatchSpanProcessorOption
+		if v := p.Batch.ScheduleDelay; v != nil {
+			opts = append(opts, sdktrace.WithBatchTimeout(millis(*v)))
+		}
+		if v := p.Batch.ExportTimeout; v != nil {
+			opts = append(opts, sdktrace.WithExportTimeout(millis(*v)))
+		}
+		if v := p.Batch.MaxQueueSize; v != nil {
+			opts = append(opts, sdktrace.WithMaxQueueSize(*v))
+		}
+		if v := p.Batch.MaxExportBatchSize; v != nil {
+			opts = append(opts, sdktrace.WithMaxExportBatchSize(*v))
+		}
+		processors = append(processors, sdktrace.NewBatchSpanProcessor(exporter, opts...))
+	}
+	return processors, nil
+}
+
+func (e SpanExporter) newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if e.Console != nil {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	}
+
+	o := e.OTLP
+	headers := make(map[string]string, len(o.Headers))
+	for _, h := range o.Headers {
+		headers[h.Name] = h.Value
+	}
+
+	if o.Protocol == "grpc" {
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithHeaders(headers)}
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if o.Compression == "gzip" {
+			opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+		}
+		if o.Timeout != nil {
+			opts = append(opts, otlptracegrpc.WithTimeout(millis(*o.Timeout)))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithHeaders(headers)}
+	if o.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(o.Endpoint))
+	}
+	if o.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if o.Compression == "gzip" {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	if o.Timeout != nil {
+		opts = append(opts, otlptracehttp.WithTimeout(millis(*o.Timeout)))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// BuildResource дополняет base атрибутами ресурса из файла; совпадающие
+// ключи берутся из файла
+func (c *Config) BuildResource(base *resource.Resource) (*resource.Resource, error) {
+	if c.Resource == nil {
+		return base, nil
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(c.Resource.Attributes))
+	for _, a := range c.Resource.Attributes {
+		kv, err := a.keyValue()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, kv)
+	}
+	res, err := resource.Merge(base, resource.NewWithAttributes(c.Resource.SchemaURL, attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("resource: %w", err)
+	}
+	return res, nil
+}
+
+// TracerProviderOptions возвращает ресурс (см. BuildResource), семплер и лимиты
+func (c *Config) TracerProviderOptions(base *resource.Resource) ([]sdktrace.TracerProviderOption, error) {
+	res, err := c.BuildResource(base)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	if c.Disabled {
+		return append(opts, sdktrace.WithSampler(sdktrace.NeverSample())), nil
+	}
+	tp := c.TracerProvider
+	if tp == nil {
+		return opts, nil
+	}
+	if tp.Sampler != nil {
+		opts = append(opts, sdktrace.WithSampler(tp.Sampler.build()))
+	}
+	if l := tp.Limits; l != nil {
+		limits := sdktrace.NewSpanLimits()
+		setLimit(&limits.AttributeValueLengthLimit, l.AttributeValueLengthLimit)
+		setLimit(&limits.AttributeCountLimit, l.AttributeCountLimit)
+		setLimit(&limits.EventCountLimit, l.EventCountLimit)
+		setLimit(&limits.LinkCountLimit, l.LinkCountLimit)
+		setLimit(&limits.AttributePerEventCountLimit, l.EventAttributeCountLimit)
+		setLimit(&limits.AttributePerLinkCountLimit, l.LinkAttributeCountLimit)
+		opts = append(opts, sdktrace.WithRawSpanLimits(limits))
+	}
+	return opts, nil
+}
+
+// Sampler возвращает семплер из tracer_provider.sampler или nil, если он не
+// задан, чтобы его можно было обернуть своим
+func (c *Config) Sampler() sdktrace.Sampler {
+	if c.TracerProvider == nil || c.TracerProvider.Sampler == nil {
+		return nil
+	}
+	return c.TracerProvider.Sampler.build()
+}
+
+func setLimit(dst *int, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// TextMapPropagator возвращает propagator из propagator.composite и false,
+// если в файле он не задан
+func (c *Config) TextMapPropagator() (propagation.TextMapPropagator, bool, error) {
+	if c.Propagator == nil {
+		return nil, false, nil
+	}
+	p, err := grpctrace.ParsePropagators(strings.Join(c.Propagator.Composite, ","))
+	if err != nil {
+		return nil, false, fmt.Errorf("propagator: %w", err)
+	}
+	return p, true, nil
+}
+
+func (s *Sampler) build() sdktrace.Sampler {
+	switch {
+	case s.AlwaysOn != nil:
+		return sdktrace.AlwaysSample()
+	case s.AlwaysOff != nil:
+		return sdktrace.NeverSample()
+	case s.TraceIDRatioBased != nil:
+		return sdktrace.TraceIDRatioBased(*s.TraceIDRatioBased.Ratio)
+	}
+
+	pb := s.ParentBased
+	root := sdktrace.AlwaysSample()
+	if pb.Root != nil {
+		root = pb.Root.build()
+	}
+	var opts []sdktrace.ParentBasedSamplerOption
+	if pb.RemoteParentSampled != nil {
+		opts = append(opts, sdktrace.WithRemoteParentSampled(pb.RemoteParentSampled.build()))
+	}
+	if pb.RemoteParentNotSampled != nil {
+		opts = append(opts, sdktrace.WithRemoteParentNotSampled(pb.RemoteParentNotSampled.build()))
+	}
+	if pb.LocalParentSampled != nil {
+		opts = append(opts, sdktrace.WithLocalParentSampled(pb.LocalParentSampled.build()))
+	}
+	if pb.LocalParentNotSampled != nil {
+		opts = append(opts, sdktrace.WithLocalParentNotSampled(pb.LocalParentNotSampled.build()))
+	}
+	return sdktrace.ParentBased(root, opts...)
+}
+
+func (a AttributeNameValue) keyValue() (attribute.KeyValue, error) {
+	key := attribute.Key(a.Name)
+	switch a.Type {
+	case "", "string":
+		if v, ok := a.Value.(string); ok {
+			return key.String(v), nil
+		}
+	case "bool":
+		if v, ok := a.Value.(bool); ok {
+			return key.Bool(v), nil
+		}
+	case "int":
+		if v, ok := a.Value.(int); ok {
+			return key.Int(v), nil
+		}
+	case "double":
+		switch v := a.Value.(type) {
+		case float64:
+			return key.Float64(v), nil
+		case int:
+			return key.Float64(float64(v)), nil
+		}
+	case "string_array", "bool_array", "int_array", "double_array":
+		return arrayKeyValue(key, a.Type, a.Value)
+	default:
+		return attribute.KeyValue{}, fmt.Errorf("attribute %q: unknown type %q", a.Name, a.Type)
+	}
+	return attribute.KeyValue{}, fmt.Errorf("attribute %q: value %v is not of type %s", a.Name, a.Value, typeName(a.Type))
+}
+
+func arrayKeyValue(key attribute.Key, typ string, value interface{}) (attribute.KeyValue, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return attribute.KeyValue{}, fmt.Errorf("attribute %q: value %v is not an array", key, value)
+	}
+	elemType := strings.TrimSuffix(typ, "_array")
+
+	var (
+		strs   []string
+		bools  []bool
+		ints   []int
+		floats []float64
+	)
+	for _, item := range items {
+		kv, err := AttributeNameValue{Name: string(key), Value: item, Type: elemType}.keyValue()
+		if err != nil {
+			return attribute.KeyValue{}, err
+		}
+		switch elemType {
+		case "string":
+			strs = append(strs, kv.Value.AsString())
+		case "bool":
+			bools = append(bools, kv.Value.AsBool())
+		case "int":
+			ints = append(ints, int(kv.Value.AsInt64()))
+		case "double":
+			floats = append(floats, kv.Value.AsFloat64())
+		}
+	}
+
+	switch elemType {
+	case "string":
+		return key.StringSlice(strs), nil
+	case "bool":
+		return key.BoolSlice(bools), nil
+	case "int":
+		return key.IntSlice(ints), nil
+	default:
+		return key.Float64Slice(floats), nil
+	}
+}
+
+func typeName(t string) string {
+	if t == "" {
+		return "string"
+	}
+	return t
+}
+
+func millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,189 @@
+// Package otlpfake реализует поддельный OTLP коллектор: он принимает трейсы
+// по OTLP/HTTP и OTLP/gRPC, хранит span в памяти и дает методы для поиска
+// по ним в тестах. Заменяет Jaeger там, где внешних сервисов нет.
+package otlpfake
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Span — полученный span вместе с ресурсом и scope, из которых он пришел
+type Span struct {
+	*tracepb.Span
+	Resource *resourcepb.Resource
+	Scope    *commonpb.InstrumentationScope
+}
+
+// TraceIDHex возвращает trace id в том же виде, что и trace.TraceID.String
+func (s Span) TraceIDHex() string {
+	return hex.EncodeToString(s.TraceId)
+}
+
+// SpanIDHex возвращает span id в том же виде, что и trace.SpanID.String
+func (s Span) SpanIDHex() string {
+	return hex.EncodeToString(s.SpanId)
+}
+
+// ParentSpanIDHex возвращает id родительского span или пустую строку для корня
+func (s Span) ParentSpanIDHex() string {
+	return hex.EncodeToString(s.ParentSpanId)
+}
+
+// ServiceName возвращает атрибут ресурса service.name
+func (s Span) ServiceName() string {
+	v, _ := lookup(s.Resource.GetAttributes(), "service.name")
+	return v.GetStringValue()
+}
+
+// Attribute ищет атрибут span по ключу
+func (s Span) Attribute(key string) (*commonpb.AnyValue, bool) {
+	return lookup(s.Attributes, key)
+}
+
+func lookup(attrs []*commonpb.KeyValue, key string) (*commonpb.AnyValue, bool) {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Option настраивает Collector
+type Option func(*Collector)
+
+// WithHTTPAddr задает адрес OTLP/HTTP приемника, по умолчанию случайный порт
+func WithHTTPAddr(addr string) Option {
+	return func(c *Collector) { c.httpAddr = addr }
+}
+
+// WithGRPCAddr задает адрес OTLP/gRPC приемника, по умолчанию случайный порт
+func WithGRPCAddr(addr string) Option {
+	return func(c *Collector) { c.grpcAddr = addr }
+}
+
+// WithOnSpans задает функцию, вызываемую для каждой пачки полученных span
+func WithOnSpans(fn func([]Span)) Option {
+	return func(c *Collector) { c.onSpans = fn }
+}
+
+// Collector — поддельный OTLP коллектор
+type Collector struct {
+	httpAddr string
+	grpcAddr string
+	onSpans  func([]Span)
+
+	httpLis    net.Listener
+	grpcLis    net.Listener
+	httpServer *http.Server
+	grpcServer *grpc.Server
+
+	mu      sync.Mutex
+	spans   []Span
+	updated chan struct{}
+}
+
+// Start запускает оба приемника и возвращает управление сразу после
+// открытия портов
+func Start(opts ...Option) (*Collector, error) {
+	c := &Collector{
+		httpAddr: "127.0.0.1:0",
+		grpcAddr: "127.0.0.1:0",
+		updated:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var err error
+	if c.httpLis, err = net.Listen("tcp", c.httpAddr); err != nil {
+		return nil, err
+	}
+	if c.grpcLis, err = net.Listen("tcp", c.grpcAddr); err != nil {
+		c.httpLis.Close()
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", c.handleHTTP)
+	c.httpServer = &http.Server{Handler: mux}
+
+	c.grpcServer = grpc.NewServer()
+	collectortracepb.RegisterTraceServiceServer(c.grpcServer, &traceService{c: c})
+
+	go c.httpServer.Serve(c.httpLis)
+	go c.grpcServer.Serve(c.grpcLis)
+
+	return c, nil
+}
+
+// HTTPEndpoint возвращает значение для OTEL_EXPORTER_OTLP_ENDPOINT при
+// экспорте по HTTP, например http://127.0.0.1:4318
+func (c *Collector) HTTPEndpoint() string {
+	return "http://" + c.httpLis.Addr().String()
+}
+
+// GRPCAddr возвращает адрес OTLP/gRPC приемника
+func (c *Collector) GRPCAddr() string {
+	return c.grpcLis.Addr().String()
+}
+
+// Shutdown останавливает приемники; полученные span остаются доступны
+func (c *Collector) Shutdown(ctx context.Context) error {
+	c.grpcServer.GracefulStop()
+	err := c.httpServer.Shutdown(ctx)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *Collector) store(req *collectortracepb.ExportTraceServiceRequest) {
+	var received []Span
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				received = append(received, Span{
+					Span:     s,
+					Resource: rs.Resource,
+					Scope:    ss.Scope,
+				})
+			}
+		}
+	}
+	if len(received) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.spans = append(c.spans, received...)
+	// Будим всех, кто ждет в WaitForSpans
+	close(c.updated)
+	c.updated = make(chan struct{})
+	c.mu.Unlock()
+
+	if c.onSpans != nil {
+		c.onSpans(received)
+	}
+}
+
+type traceService struct {
+	collectortracepb.UnimplementedTraceServiceServer
+	c *Collector
+}
+
+func (s *traceService) Export(_ context.Context, req *collectortracepb.ExportTraceServiceRequest) (*collectortracepb.ExportTraceServiceResponse, error) {
+	s.c.store(req)
+	return &collectortracepb.ExportTraceServiceResponse{}, nil
+}
@@ -0,0 +1,159 @@
+package otlpfake_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/otlpfake"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startCollector(t *testing.T, opts ...otlpfake.Option) *otlpfake.Collector {
+	t.Helper()
+	c, err := otlpfake.Start(opts...)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { _ = c.Shutdown(context.Background()) })
+	return c
+}
+
+// newProvider отправляет каждый завершенный span в коллектор сразу
+func newProvider(t *testing.T, service string, exporter sdktrace.SpanExporter) trace.Tracer {
+	t.Helper()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp.Tracer("otlpfake-test")
+}
+
+func TestCollectorQueries(t *testing.T) {
+	ctx := context.Background()
+	var batches int
+	c := startCollector(t, otlpfake.WithOnSpans(func([]otlpfake.Span) { batches++ }))
+
+	httpExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(c.HTTPEndpoint()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(c.GRPCAddr()), otlptracegrpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newProvider(t, "client", httpExporter)
+	server := newProvider(t, "server", grpcExporter)
+
+	// Первый trace проходит через оба сервиса, второй — только клиент
+	ctx1, root := client.Start(ctx, "call")
+	_, child := server.Start(ctx1, "handle", trace.WithAttributes(attribute.String("rpc.method", "SayHello")))
+	child.End()
+	root.End()
+	_, other := client.Start(ctx, "call")
+	other.End()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	spans, err := c.WaitForSpans(waitCtx, 3)
+	if err != nil {
+		t.Fatalf("WaitForSpans() error = %v, got %d spans", err, len(spans))
+	}
+	if batches != 3 {
+		t.Errorf("OnSpans called %d times, want 3", batches)
+	}
+
+	if got := len(c.SpansByName("call")); got != 2 {
+		t.Errorf("SpansByName(call) = %d spans, want 2", got)
+	}
+	if got := c.SpansByService("server"); len(got) != 1 || got[0].Name != "handle" {
+		t.Errorf("SpansByService(server) = %v, want the handle span", got)
+	}
+
+	ids := c.TraceIDs()
+	want := []string{root.SpanContext().TraceID().String(), other.SpanContext().TraceID().String()}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("TraceIDs() = %v, want %v", ids, want)
+	}
+
+	first := c.Trace(want[0])
+	if len(first) != 2 {
+		t.Fatalf("Trace(%s) = %d spans, want 2", want[0], len(first))
+	}
+	handle := c.SpansByName("handle")[0]
+	if handle.ParentSpanIDHex() != root.SpanContext().SpanID().String() {
+		t.Errorf("handle parent = %s, want %s", handle.ParentSpanIDHex(), root.SpanContext().SpanID())
+	}
+	if v, ok := handle.Attribute("rpc.method"); !ok || v.GetStringValue() != "SayHello" {
+		t.Errorf("handle rpc.method = %v, want SayHello", v)
+	}
+	if _, ok := handle.Attribute("missing"); ok {
+		t.Error("Attribute(missing) found a value")
+	}
+
+	var out bytes.Buffer
+	otlpfake.Print(&out, []otlpfake.Span{handle})
+	for _, s := range []string{"server [INTERNAL] handle", "parent=" + root.SpanContext().SpanID().String(), `rpc.method="SayHello"`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Print() output %q does not contain %q", out.String(), s)
+		}
+	}
+
+	c.Reset()
+	if got := len(c.Spans()); got != 0 {
+		t.Errorf("Spans() after Reset = %d, want 0", got)
+	}
+}
+
+func TestWaitForSpansTimeout(t *testing.T) {
+	c := startCollector(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	spans, err := c.WaitForSpans(ctx, 1)
+	if !errors.Is(err, context.DeadlineExceeded) || len(spans) != 0 {
+		t.Errorf("WaitForSpans() = %d spans, %v; want none and DeadlineExceeded", len(spans), err)
+	}
+}
+
+func TestHTTPJSON(t *testing.T) {
+	c := startCollector(t)
+
+	body := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"curl"}}]},` +
+		`"scopeSpans":[{"spans":[{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","name":"manual","startTimeUnixNano":1700000000123456789}]}]}]}`
+	resp, err := http.Post(c.HTTPEndpoint()+"/v1/traces", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("POST status = %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	spans := c.SpansByService("curl")
+	if len(spans) != 1 || spans[0].TraceIDHex() != "4bf92f3577b34da6a3ce929d0e0e4736" || spans[0].SpanIDHex() != "00f067aa0ba902b7" {
+		t.Fatalf("SpansByService(curl) = %v, want the posted span", spans)
+	}
+	if got := spans[0].StartTimeUnixNano; got != 1700000000123456789 {
+		t.Errorf("start time = %d, want 1700000000123456789", got)
+	}
+
+	resp, err = http.Post(c.HTTPEndpoint()+"/v1/traces", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("POST text/plain status = %d, want %d", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+}
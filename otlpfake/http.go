@@ -0,0 +1,129 @@
+package otlpfake
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// handleHTTP принимает OTLP/HTTP запрос в protobuf или JSON кодировке
+func (c *Collector) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &collectortracepb.ExportTraceServiceRequest{}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json":
+		if data, err = hexIDsToBase64(data); err == nil {
+			err = protojson.Unmarshal(data, req)
+		}
+	case "application/x-protobuf":
+		err = proto.Unmarshal(data, req)
+	default:
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.store(req)
+
+	// Отвечаем в той же кодировке, в которой пришел запрос
+	resp := &collectortracepb.ExportTraceServiceResponse{}
+	var out []byte
+	if contentType == "application/json" {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(out); err != nil {
+		log.Printf("otlpfake: failed to write response: %v", err)
+	}
+}
+
+// idFields — поля с trace и span id: в OTLP/JSON они записаны в hex, а
+// protojson ожидает для bytes base64
+var idFields = map[string]bool{
+	"traceId": true, "trace_id": true,
+	"spanId": true, "span_id": true,
+	"parentSpanId": true, "parent_span_id": true,
+}
+
+// hexIDsToBase64 переписывает id в запросе OTLP/JSON в base64
+func hexIDsToBase64(data []byte) ([]byte, error) {
+	// Числа оставляем как есть: наносекунды времени не влезают в float64
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := convertIDs(doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+func convertIDs(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if s, ok := field.(string); ok && idFields[key] {
+				id, err := hex.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+				v[key] = base64.StdEncoding.EncodeToString(id)
+				continue
+			}
+			if err := convertIDs(field); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := convertIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
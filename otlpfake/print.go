@@ -0,0 +1,72 @@
+package otlpfake
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Print выводит span в читаемом виде: по строке на span, атрибуты и
+// события с отступом
+func Print(w io.Writer, spans []Span) {
+	for _, s := range spans {
+		start := time.Unix(0, int64(s.StartTimeUnixNano))
+		duration := time.Duration(s.EndTimeUnixNano - s.StartTimeUnixNano)
+
+		fmt.Fprintf(w, "%s %s [%s] %s %s trace=%s span=%s",
+			start.Format("15:04:05.000000"),
+			s.ServiceName(),
+			strings.TrimPrefix(s.Kind.String(), "SPAN_KIND_"),
+			s.Name,
+			duration,
+			s.TraceIDHex(),
+			s.SpanIDHex(),
+		)
+		if len(s.ParentSpanId) > 0 {
+			fmt.Fprintf(w, " parent=%s", s.ParentSpanIDHex())
+		}
+		if code := s.Status.GetCode(); code != tracepb.Status_STATUS_CODE_UNSET {
+			fmt.Fprintf(w, " status=%s", strings.TrimPrefix(code.String(), "STATUS_CODE_"))
+			if msg := s.Status.GetMessage(); msg != "" {
+				fmt.Fprintf(w, " %q", msg)
+			}
+		}
+		fmt.Fprintln(w)
+
+		for _, kv := range s.Attributes {
+			fmt.Fprintf(w, "    %s=%s\n", kv.Key, formatValue(kv.Value))
+		}
+		for _, e := range s.Events {
+			fmt.Fprintf(w, "    event %s", e.Name)
+			for _, kv := range e.Attributes {
+				fmt.Fprintf(w, " %s=%s", kv.Key, formatValue(kv.Value))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func formatValue(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return fmt.Sprintf("%q", v.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return fmt.Sprint(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return fmt.Sprint(v.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return fmt.Sprint(v.DoubleValue)
+	case *commonpb.AnyValue_ArrayValue:
+		items := make([]string, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			items = append(items, formatValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
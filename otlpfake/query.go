@@ -0,0 +1,82 @@
+package otlpfake
+
+import (
+	"context"
+)
+
+// Spans возвращает все полученные span в порядке поступления
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Span(nil), c.spans...)
+}
+
+// Filter возвращает span, для которых match вернул true
+func (c *Collector) Filter(match func(Span) bool) []Span {
+	var result []Span
+	for _, s := range c.Spans() {
+		if match(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// SpansByName возвращает span с заданным именем
+func (c *Collector) SpansByName(name string) []Span {
+	return c.Filter(func(s Span) bool { return s.Name == name })
+}
+
+// SpansByService возвращает span, отправленные сервисом с заданным service.name
+func (c *Collector) SpansByService(service string) []Span {
+	return c.Filter(func(s Span) bool { return s.ServiceName() == service })
+}
+
+// Trace возвращает все span trace с заданным hex trace id
+func (c *Collector) Trace(traceID string) []Span {
+	return c.Filter(func(s Span) bool { return s.TraceIDHex() == traceID })
+}
+
+// TraceIDs возвращает id всех trace в порядке первого появления
+func (c *Collector) TraceIDs() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, s := range c.Spans() {
+		id := s.TraceIDHex()
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Reset удаляет все полученные span
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.spans = nil
+}
+
+// WaitForSpans ждет, пока коллектор получит хотя бы n span, или пока не
+// отменится ctx. Нужен потому, что экспорт идет асинхронно пачками.
+func (c *Collector) WaitForSpans(ctx context.Context, n int) ([]Span, error) {
+	for {
+		c.mu.Lock()
+		if len(c.spans) >= n {
+			spans := append([]Span(nil), c.spans...)
+			c.mu.Unlock()
+			return spans, nil
+		}
+		updated := c.updated
+		c.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return c.Spans(), ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,295 @@
+// Команда protoc-gen-go-traced — плагин protoc, который рядом с
+// *_grpc.pb.go генерирует *_traced.pb.go: обертки клиентов и серверов,
+// создающие span для каждого unary метода, и методы TraceAttributes
+// сообщений, достающие поля с опцией (trace.attribute) без рефлексии.
+//
+//	protoc --go-traced_out=. --go-traced_opt=module=<module> proto/hello.proto
+package main
+
+import (
+	"fmt"
+
+	"github.com/DifferentialOrange/go-tracing-example/traceopts"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+const version = "1.0.0"
+
+const (
+	contextPackage   = protogen.GoImportPath("context")
+	grpcPackage      = protogen.GoImportPath("google.golang.org/grpc")
+	attributePackage = protogen.GoImportPath("go.opentelemetry.io/otel/attribute")
+	tracePackage     = protogen.GoImportPath("go.opentelemetry.io/otel/trace")
+	grpctracePackage = protogen.GoImportPath("github.com/DifferentialOrange/go-tracing-example/grpctrace")
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+		for _, f := range gen.Files {
+			if !f.Generate {
+				continue
+			}
+			if err := generateFile(gen, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File) error {
+	if len(file.Services) == 0 && len(file.Messages) == 0 {
+		return nil
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_traced.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-go-traced. DO NOT EDIT.")
+	g.P("// versions:")
+	g.P("// - protoc-gen-go-traced v", version)
+	g.P("// - protoc             ", protocVersion(gen))
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+
+	for _, m := range file.Messages {
+		if err := generateTraceAttributes(g, file, m); err != nil {
+			return err
+		}
+	}
+	for _, s := range file.Services {
+		generateClient(g, s)
+		generateServer(g, s)
+	}
+	return nil
+}
+
+func protocVersion(gen *protogen.Plugin) string {
+	v := gen.Request.GetCompilerVersion()
+	if v == nil {
+		return "(unknown)"
+	}
+	var suffix string
+	if s := v.GetSuffix(); s != "" {
+		suffix = "-" + s
+	}
+	return fmt.Sprintf("v%d.%d.%d%s", v.GetMajor(), v.GetMinor(), v.GetPatch(), suffix)
+}
+
+// generateTraceAttributes генерирует TraceAttributes для сообщения и всех
+// вложенных в него объявлений сообщений
+func generateTraceAttributes(g *protogen.GeneratedFile, file *protogen.File, m *protogen.Message) error {
+	for _, nested := range m.Messages {
+		if nested.Desc.IsMapEntry() {
+			continue
+		}
+		if err := generateTraceAttributes(g, file, nested); err != nil {
+			return err
+		}
+	}
+
+	g.P("// TraceAttributes возвращает атрибуты span из полей с опцией (trace.attribute)")
+	g.P("func (x *", m.GoIdent, ") TraceAttributes() []", attributePackage.Ident("KeyValue"), " {")
+	if !hasTraceAttributes(file, m) {
+		g.P("return nil")
+		g.P("}")
+		g.P()
+		return nil
+	}
+	g.P("if x == nil {")
+	g.P("return nil")
+	g.P("}")
+	g.P("var attrs []", attributePackage.Ident("KeyValue"))
+	for _, field := range m.Fields {
+		opts := field.Desc.Options()
+		name := proto.GetExtension(opts, traceopts.E_Attribute).(string)
+		sensitive := proto.GetExtension(opts, traceopts.E_Sensitive).(bool)
+
+		// Вложенные сообщения из того же пакета отдают свои атрибуты сами;
+		// секретные сообщения не раскрываются целиком
+		if name == "" && !sensitive && field.Message != nil && !field.Desc.IsList() && !field.Desc.IsMap() &&
+			field.Message.GoIdent.GoImportPath == file.GoImportPath {
+			g.P("attrs = append(attrs, x.Get", field.GoName, "().TraceAttributes()...)")
+			continue
+		}
+		if name == "" {
+			continue
+		}
+
+		value, err := attributeValue(g, field, name, sensitive)
+		if err != nil {
+			return err
+		}
+		if field.Desc.HasPresence() {
+			g.P("if ", presence(field), " {")
+			g.P("attrs = append(attrs, ", value, ")")
+			g.P("}")
+		} else {
+			// Как и в protoreflect, нулевые значения полей без presence не пишем
+			g.P("if ", notZero(field), " {")
+			g.P("attrs = append(attrs, ", value, ")")
+			g.P("}")
+		}
+	}
+	g.P("return attrs")
+	g.P("}")
+	g.P()
+	return nil
+}
+
+// hasTraceAttributes сообщает, есть ли у сообщения поля для атрибутов,
+// в том числе во вложенных сообщениях того же пакета
+func hasTraceAttributes(file *protogen.File, m *protogen.Message) bool {
+	return hasTraceAttributesSeen(file, m, map[*protogen.Message]bool{})
+}
+
+func hasTraceAttributesSeen(file *protogen.File, m *protogen.Message, seen map[*protogen.Message]bool) bool {
+	if seen[m] {
+		return false
+	}
+	seen[m] = true
+	for _, field := range m.Fields {
+		opts := field.Desc.Options()
+		if proto.GetExtension(opts, traceopts.E_Attribute).(string) != "" {
+			return true
+		}
+		if field.Message != nil && !field.Desc.IsList() && !field.Desc.IsMap() &&
+			field.Message.GoIdent.GoImportPath == file.GoImportPath &&
+			!proto.GetExtension(opts, traceopts.E_Sensitive).(bool) &&
+			hasTraceAttributesSeen(file, field.Message, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func presence(field *protogen.Field) string {
+	if field.Oneof != nil && !field.Oneof.Desc.IsSynthetic() {
+		return fmt.Sprintf("_, ok := x.Get%s().(*%s); ok", field.Oneof.GoName, field.GoIdent.GoName)
+	}
+	return fmt.Sprintf("x.%s != nil", field.GoName)
+}
+
+func notZero(field *protogen.Field) string {
+	if field.Desc.IsList() || field.Desc.IsMap() || field.Desc.Kind() == protoreflect.BytesKind {
+		return fmt.Sprintf("len(x.Get%s()) != 0", field.GoName)
+	}
+	switch field.Desc.Kind() {
+	case protoreflect.StringKind:
+		return fmt.Sprintf("x.Get%s() != \"\"", field.GoName)
+	case protoreflect.BoolKind:
+		return fmt.Sprintf("x.Get%s()", field.GoName)
+	default:
+		return fmt.Sprintf("x.Get%s() != 0", field.GoName)
+	}
+}
+
+// attributeValue возвращает выражение attribute.KeyValue для поля
+func attributeValue(g *protogen.GeneratedFile, field *protogen.Field, name string, sensitive bool) (string, error) {
+	key := fmt.Sprintf("%q", name)
+	getter := fmt.Sprintf("x.Get%s()", field.GoName)
+	ident := func(fn string) string { return g.QualifiedGoIdent(attributePackage.Ident(fn)) }
+
+	if sensitive {
+		return fmt.Sprintf("%s(%s, %s)", ident("String"), key, g.QualifiedGoIdent(grpctracePackage.Ident("RedactedValue"))), nil
+	}
+	if field.Desc.IsList() || field.Desc.IsMap() || field.Message != nil {
+		return "", fmt.Errorf("%s: (trace.attribute) is supported only for scalar and enum fields", field.Desc.FullName())
+	}
+
+	switch field.Desc.Kind() {
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%s(%s, %s)", ident("String"), key, getter), nil
+	case protoreflect.BoolKind:
+		return fmt.Sprintf("%s(%s, %s)", ident("Bool"), key, getter), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return fmt.Sprintf("%s(%s, int64(%s))", ident("Int64"), key, getter), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return fmt.Sprintf("%s(%s, float64(%s))", ident("Float64"), key, getter), nil
+	case protoreflect.EnumKind:
+		return fmt.Sprintf("%s(%s, %s.String())", ident("String"), key, getter), nil
+	default:
+		return "", fmt.Errorf("%s: (trace.attribute) is not supported for %s fields", field.Desc.FullName(), field.Desc.Kind())
+	}
+}
+
+func isUnary(m *protogen.Method) bool {
+	return !m.Desc.IsStreamingClient() && !m.Desc.IsStreamingServer()
+}
+
+func fullMethodName(s *protogen.Service, m *protogen.Method) string {
+	return fmt.Sprintf("%s_%s_FullMethodName", s.GoName, m.GoName)
+}
+
+func generateClient(g *protogen.GeneratedFile, s *protogen.Service) {
+	clientName := s.GoName + "Client"
+	typeName := "traced" + clientName
+
+	g.P("type ", typeName, " struct {")
+	g.P(clientName)
+	g.P("w *", grpctracePackage.Ident("Wrapper"))
+	g.P("}")
+	g.P()
+	g.P("// NewTraced", clientName, " оборачивает клиент так, что каждый unary вызов")
+	g.P("// создает span и передает контекст трассировки серверу. Потоковые методы")
+	g.P("// вызываются без изменений.")
+	g.P("func NewTraced", clientName, "(c ", clientName, ", tracer ", tracePackage.Ident("Tracer"),
+		", opts ...", grpctracePackage.Ident("Option"), ") ", clientName, " {")
+	g.P("return &", typeName, "{", clientName, ": c, w: ", grpctracePackage.Ident("NewWrapper"), "(tracer, opts...)}")
+	g.P("}")
+	g.P()
+
+	for _, m := range s.Methods {
+		if !isUnary(m) {
+			continue
+		}
+		g.P("func (c *", typeName, ") ", m.GoName, "(ctx ", contextPackage.Ident("Context"), ", in *", m.Input.GoIdent,
+			", opts ...", grpcPackage.Ident("CallOption"), ") (*", m.Output.GoIdent, ", error) {")
+		g.P("ctx, span := c.w.StartClientSpan(ctx, ", fullMethodName(s, m), ", in.TraceAttributes()...)")
+		g.P("out, err := c.", clientName, ".", m.GoName, "(ctx, in, opts...)")
+		g.P("c.w.EndClientSpan(span, ", fullMethodName(s, m), ", err, out.TraceAttributes()...)")
+		g.P("return out, err")
+		g.P("}")
+		g.P()
+	}
+}
+
+func generateServer(g *protogen.GeneratedFile, s *protogen.Service) {
+	serverName := s.GoName + "Server"
+	typeName := "traced" + serverName
+
+	g.P("type ", typeName, " struct {")
+	g.P(serverName)
+	g.P("w *", grpctracePackage.Ident("Wrapper"))
+	g.P("}")
+	g.P()
+	g.P("// NewTraced", serverName, " оборачивает реализацию сервиса так, что каждый")
+	g.P("// unary вызов создает span, продолжающий trace клиента. Опции те же, что у")
+	g.P("// серверного interceptor: доверие, флаг отладки, часы и политики методов.")
+	g.P("// Потоковые методы вызываются без изменений.")
+	g.P("func NewTraced", serverName, "(s ", serverName, ", tracer ", tracePackage.Ident("Tracer"),
+		", opts ...", grpctracePackage.Ident("Option"), ") ", serverName, " {")
+	g.P("return &", typeName, "{", serverName, ": s, w: ", grpctracePackage.Ident("NewWrapper"), "(tracer, opts...)}")
+	g.P("}")
+	g.P()
+
+	for _, m := range s.Methods {
+		if !isUnary(m) {
+			continue
+		}
+		g.P("func (s *", typeName, ") ", m.GoName, "(ctx ", contextPackage.Ident("Context"), ", in *", m.Input.GoIdent,
+			") (*", m.Output.GoIdent, ", error) {")
+		g.P("ctx, span := s.w.StartServerSpan(ctx, ", fullMethodName(s, m), ", in.TraceAttributes()...)")
+		g.P("out, err := s.", serverName, ".", m.GoName, "(ctx, in)")
+		g.P("s.w.EndServerSpan(ctx, span, ", fullMethodName(s, m), ", err, out.TraceAttributes()...)")
+		g.P("return out, err")
+		g.P("}")
+		g.P()
+	}
+}
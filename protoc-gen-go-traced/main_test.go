@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/admin"
+	"github.com/DifferentialOrange/go-tracing-example/hello"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestGenerateGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		file protoreflect.FileDescriptor
+	}{
+		{name: "hello_traced.pb.go", file: hello.File_proto_hello_proto},
+		{name: "admin_traced.pb.go", file: admin.File_proto_admin_proto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generate(t, tt.file)
+
+			path := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("generated %s differs from %s; run with -update and review the diff", tt.name, path)
+			}
+		})
+	}
+}
+
+// generate запускает плагин для file так же, как protoc: в запросе файл и
+// все его зависимости, зависимости раньше зависящих от них
+func generate(t *testing.T, file protoreflect.FileDescriptor) []byte {
+	t.Helper()
+
+	var (
+		protos []*descriptorpb.FileDescriptorProto
+		seen   = map[string]bool{}
+		add    func(fd protoreflect.FileDescriptor)
+	)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		protos = append(protos, protodesc.ToFileDescriptorProto(fd))
+	}
+	add(file)
+
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate:  []string{file.Path()},
+		Parameter:       proto.String("module=github.com/DifferentialOrange/go-tracing-example"),
+		ProtoFile:       protos,
+		CompilerVersion: &pluginpb.Version{Major: proto.Int32(4), Minor: proto.Int32(25), Patch: proto.Int32(8)},
+	}
+	gen, err := protogen.Options{}.New(req)
+	if err != nil {
+		t.Fatalf("protogen.New() error = %v", err)
+	}
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		if err := generateFile(gen, f); err != nil {
+			t.Fatalf("generateFile(%s) error = %v", f.Desc.Path(), err)
+		}
+	}
+
+	resp := gen.Response()
+	if resp.Error != nil {
+		t.Fatalf("plugin error: %s", resp.GetError())
+	}
+	if len(resp.File) != 1 {
+		t.Fatalf("plugin generated %d files, want 1", len(resp.File))
+	}
+	return []byte(resp.File[0].GetContent())
+}
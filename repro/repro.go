@@ -0,0 +1,143 @@
+// Package repro делает трассировку воспроизводимой: генератор идентификаторов
+// с фиксированным seed и часы, время на которых идет только по Sleep. Два
+// прогона одного сценария с одинаковым seed дают одинаковые trace.
+package repro
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Clock — источник времени для span, метрик и имитации работы
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RealClock — обычные часы
+type RealClock struct{}
+
+// Now возвращает текущее время
+func (RealClock) Now() time.Time { return time.Now() }
+
+// Sleep приостанавливает выполнение на d
+func (RealClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Epoch — начальное время FakeClock по умолчанию
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FakeClock — часы, которые стоят на месте, пока их не сдвинет Sleep или
+// Advance. Sleep возвращается сразу, поэтому сценарии выполняются мгновенно.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock создает часы, показывающие start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now возвращает текущее время часов
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep сдвигает часы на d, не приостанавливая выполнение
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance сдвигает часы на d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// IDGenerator выдает trace и span id из генератора с фиксированным seed.
+// Последовательность повторяется, только если span создаются в том же
+// порядке, поэтому сценарий должен выполняться последовательно.
+type IDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var _ sdktrace.IDGenerator = (*IDGenerator)(nil)
+
+// NewIDGenerator создает генератор с заданным seed
+func NewIDGenerator(seed int64) *IDGenerator {
+	return &IDGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// NewIDs возвращает новые trace id и span id
+func (g *IDGenerator) NewIDs(context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.traceID(), g.spanID()
+}
+
+// NewSpanID возвращает новый span id для существующего trace
+func (g *IDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.spanID()
+}
+
+// Нулевые идентификаторы недействительны, поэтому пропускаем их
+func (g *IDGenerator) traceID() trace.TraceID {
+	var id trace.TraceID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], g.rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], g.rand.Uint64())
+	}
+	return id
+}
+
+func (g *IDGenerator) spanID() trace.SpanID {
+	var id trace.SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], g.rand.Uint64())
+	}
+	return id
+}
+
+// Rand — источник случайных чисел для имитации работы в сценарии; в отличие
+// от rand.Rand его можно использовать из нескольких горутин
+type Rand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRand создает источник с заданным seed; при seed == 0 — случайный
+func NewRand(seed int64) *Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Rand{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Float64 возвращает число из [0, 1)
+func (r *Rand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Float64()
+}
+
+// TracerProviderOptions возвращает настройки TracerProvider и часы для
+// сценария: при seed == 0 — случайные id и обычные часы, иначе генератор
+// с этим seed и FakeClock, начинающиеся с Epoch
+func TracerProviderOptions(seed int64) ([]sdktrace.TracerProviderOption, Clock) {
+	if seed == 0 {
+		return nil, RealClock{}
+	}
+	return []sdktrace.TracerProviderOption{sdktrace.WithIDGenerator(NewIDGenerator(seed))}, NewFakeClock(Epoch)
+}
@@ -0,0 +1,52 @@
+package repro
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIDGeneratorIsReproducible(t *testing.T) {
+	a, b := NewIDGenerator(42), NewIDGenerator(42)
+	for i := 0; i < 10; i++ {
+		traceA, spanA := a.NewIDs(context.Background())
+		traceB, spanB := b.NewIDs(context.Background())
+		if traceA != traceB || spanA != spanB {
+			t.Fatalf("ids differ at step %d: %s/%s vs %s/%s", i, traceA, spanA, traceB, spanB)
+		}
+		if !traceA.IsValid() || !spanA.IsValid() {
+			t.Fatalf("invalid ids at step %d: %s/%s", i, traceA, spanA)
+		}
+		if a.NewSpanID(context.Background(), traceA) != b.NewSpanID(context.Background(), traceB) {
+			t.Fatalf("span ids differ at step %d", i)
+		}
+	}
+
+	other, _ := NewIDGenerator(43).NewIDs(context.Background())
+	first, _ := NewIDGenerator(42).NewIDs(context.Background())
+	if other == first {
+		t.Errorf("different seeds produced the same trace id %s", first)
+	}
+}
+
+func TestRandIsReproducible(t *testing.T) {
+	a, b := NewRand(42), NewRand(42)
+	for i := 0; i < 10; i++ {
+		if x, y := a.Float64(), b.Float64(); x != y {
+			t.Fatalf("values differ at step %d: %v vs %v", i, x, y)
+		}
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(Epoch)
+
+	start := time.Now()
+	clock.Sleep(time.Hour)
+	if time.Since(start) > time.Second {
+		t.Errorf("Sleep blocked for %v", time.Since(start))
+	}
+	if got := clock.Now().Sub(Epoch); got != time.Hour {
+		t.Errorf("clock advanced by %v, want %v", got, time.Hour)
+	}
+}
@@ -0,0 +1,164 @@
+// Package sampling содержит семплер, долю и правила по методам которого можно
+// менять во время работы процесса без перезапуска.
+package sampling
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Rule задает долю семплирования для методов, подходящих под Pattern —
+// полное имя метода или glob в синтаксисе path.Match
+type Rule struct {
+	Pattern string
+	Ratio   float64
+}
+
+// Config — доля по умолчанию и правила; первое подходящее правило побеждает
+type Config struct {
+	Ratio float64
+	Rules []Rule
+}
+
+// Validate проверяет доли и шаблоны
+func (c Config) Validate() error {
+	if c.Ratio < 0 || c.Ratio > 1 {
+		return fmt.Errorf("sampling ratio must be in [0, 1], got %g", c.Ratio)
+	}
+	for _, r := range c.Rules {
+		if r.Pattern == "" {
+			return errors.New("rule pattern must not be empty")
+		}
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Pattern, err)
+		}
+		if r.Ratio < 0 || r.Ratio > 1 {
+			return fmt.Errorf("rule %q: sampling ratio must be in [0, 1], got %g", r.Pattern, r.Ratio)
+		}
+	}
+	return nil
+}
+
+func (c Config) String() string {
+	rules := make([]string, len(c.Rules))
+	for i, r := range c.Rules {
+		rules[i] = fmt.Sprintf("%s=%g", r.Pattern, r.Ratio)
+	}
+	return fmt.Sprintf("ratio=%g rules=[%s]", c.Ratio, strings.Join(rules, ","))
+}
+
+// ParseRules разбирает правила вида "/hello.Greeter/*=0.5,/admin.Admin/*=1"
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	if strings.TrimSpace(s) == "" {
+		return rules, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		pattern, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || pattern == "" || value == "" {
+			return nil, fmt.Errorf("invalid sampling rule %q, expected pattern=ratio", item)
+		}
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: sampling ratio must be a number, got %q", pattern, value)
+		}
+		rules = append(rules, Rule{Pattern: pattern, Ratio: ratio})
+	}
+	return rules, nil
+}
+
+// Sampler семплирует span по правилу для rpc.method (или имени span, если
+// атрибута нет) и по доле по умолчанию для остальных. Конфигурация
+// заменяется целиком, так что span никогда не видит ее наполовину.
+type Sampler struct {
+	state atomic.Pointer[state]
+}
+
+var _ sdktrace.Sampler = (*Sampler)(nil)
+
+type state struct {
+	config   Config
+	fallback sdktrace.Sampler
+	rules    []sdktrace.Sampler
+}
+
+// NewSampler создает Sampler с начальной конфигурацией
+func NewSampler(cfg Config) (*Sampler, error) {
+	st, err := newState(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sampler{}
+	s.state.Store(st)
+	return s, nil
+}
+
+func newState(cfg Config) (*state, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	// Копируем правила, чтобы вызывающий не мог изменить их после проверки
+	cfg.Rules = append([]Rule(nil), cfg.Rules...)
+	st := &state{config: cfg, fallback: sdktrace.TraceIDRatioBased(cfg.Ratio)}
+	for _, r := range cfg.Rules {
+		st.rules = append(st.rules, sdktrace.TraceIDRatioBased(r.Ratio))
+	}
+	return st, nil
+}
+
+// snapshot возвращает копию конфигурации, которую можно менять
+func (st *state) snapshot() Config {
+	cfg := st.config
+	cfg.Rules = append([]Rule(nil), cfg.Rules...)
+	return cfg
+}
+
+// Config возвращает текущую конфигурацию
+func (s *Sampler) Config() Config {
+	return s.state.Load().snapshot()
+}
+
+// Update применяет fn к текущей конфигурации и атомарно устанавливает
+// результат. Если конфигурацию одновременно изменил кто-то еще, fn
+// вызывается снова с новой. При ошибке проверки ничего не меняется.
+func (s *Sampler) Update(fn func(Config) Config) (prev, next Config, err error) {
+	for {
+		old := s.state.Load()
+		st, err := newState(fn(old.snapshot()))
+		if err != nil {
+			return old.snapshot(), old.snapshot(), err
+		}
+		if s.state.CompareAndSwap(old, st) {
+			return old.snapshot(), st.snapshot(), nil
+		}
+	}
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	st := s.state.Load()
+
+	method := p.Name
+	for _, kv := range p.Attributes {
+		if kv.Key == "rpc.method" {
+			method = kv.Value.AsString()
+			break
+		}
+	}
+	for i, r := range st.config.Rules {
+		if ok, _ := path.Match(r.Pattern, method); ok {
+			return st.rules[i].ShouldSample(p)
+		}
+	}
+	return st.fallback.ShouldSample(p)
+}
+
+func (s *Sampler) Description() string {
+	st := s.state.Load()
+	return fmt.Sprintf("DynamicSampler{ratio=%g,rules=%d}", st.config.Ratio, len(st.config.Rules))
+}
@@ -0,0 +1,111 @@
+package sampling
+
+import (
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func decision(s *Sampler, method string) sdktrace.SamplingDecision {
+	return s.ShouldSample(sdktrace.SamplingParameters{
+		TraceID:    trace.TraceID{1},
+		Name:       "span",
+		Attributes: []attribute.KeyValue{attribute.String("rpc.method", method)},
+	}).Decision
+}
+
+func TestRules(t *testing.T) {
+	s, err := NewSampler(Config{Ratio: 0, Rules: []Rule{
+		{Pattern: "/hello.Greeter/SayHello", Ratio: 0},
+		{Pattern: "/hello.Greeter/*", Ratio: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		want   sdktrace.SamplingDecision
+	}{
+		{"/hello.Greeter/SayHello", sdktrace.Drop},
+		{"/hello.Greeter/SayBye", sdktrace.RecordAndSample},
+		{"/admin.Admin/GetSampling", sdktrace.Drop},
+	}
+	for _, tt := range tests {
+		if got := decision(s, tt.method); got != tt.want {
+			t.Errorf("%s: decision = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s, err := NewSampler(Config{Ratio: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev, next, err := s.Update(func(c Config) Config {
+		c.Ratio = 1
+		return c
+	})
+	if err != nil || prev.Ratio != 0 || next.Ratio != 1 {
+		t.Fatalf("Update() = %v, %v, %v", prev, next, err)
+	}
+	if got := decision(s, "/hello.Greeter/SayHello"); got != sdktrace.RecordAndSample {
+		t.Errorf("decision after update = %v", got)
+	}
+
+	// Неверная конфигурация не применяется даже частично
+	_, _, err = s.Update(func(c Config) Config {
+		c.Ratio = 0
+		c.Rules = []Rule{{Pattern: "[", Ratio: 1}}
+		return c
+	})
+	if err == nil {
+		t.Fatal("Update() with invalid pattern succeeded")
+	}
+	if got := s.Config(); got.Ratio != 1 || len(got.Rules) != 0 {
+		t.Errorf("config after failed update = %v", got)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	s, err := NewSampler(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = s.Update(func(c Config) Config {
+				c.Rules = append(c.Rules, Rule{Pattern: "/a/*", Ratio: 1})
+				return c
+			})
+			decision(s, "/a/b")
+		}()
+	}
+	wg.Wait()
+
+	if got := len(s.Config().Rules); got != 50 {
+		t.Errorf("rules after concurrent updates = %d, want 50", got)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("/hello.Greeter/*=0.5, /admin.Admin/*=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[1] != (Rule{Pattern: "/admin.Admin/*", Ratio: 1}) {
+		t.Errorf("ParseRules() = %v", rules)
+	}
+	if _, err := ParseRules("/hello.Greeter/*"); err == nil {
+		t.Error("ParseRules() without ratio succeeded")
+	}
+}
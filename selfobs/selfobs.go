@@ -0,0 +1,166 @@
+// Package selfobs добавляет наблюдаемость самому конвейеру трассировки:
+// ошибки SDK пишутся в лог, а число созданных, завершенных, отправленных и
+// потерянных span и задержка экспорта публикуются как метрики.
+package selfobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const scopeName = "github.com/DifferentialOrange/go-tracing-example/selfobs"
+
+// sdkSelfObservabilityEnv включает экспериментальные метрики SDK, среди
+// которых otel.sdk.processor.span.processed с error.type=queue_full —
+// единственный способ узнать, сколько span отбросил BatchSpanProcessor
+const sdkSelfObservabilityEnv = "OTEL_GO_X_SELF_OBSERVABILITY"
+
+// InstallErrorHandler направляет ошибки OTel SDK (в том числе ошибки
+// экспорта из BatchSpanProcessor) в стандартный логгер и считает их
+func InstallErrorHandler() {
+	errors, err := otel.Meter(scopeName).Int64Counter("tracing.pipeline.errors",
+		metric.WithDescription("Number of errors reported by the OpenTelemetry SDK."),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		log.Printf("otel: failed to create error counter: %v", err)
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Printf("otel: %v", err)
+		if errors != nil {
+			errors.Add(context.Background(), 1)
+		}
+	}))
+}
+
+// EnableSDKMetrics включает встроенные метрики SDK, если пользователь не
+// задал OTEL_GO_X_SELF_OBSERVABILITY сам. Вызывать до создания
+// BatchSpanProcessor: SDK читает переменную при его создании.
+func EnableSDKMetrics() {
+	if _, ok := os.LookupEnv(sdkSelfObservabilityEnv); ok {
+		return
+	}
+	if err := os.Setenv(sdkSelfObservabilityEnv, "true"); err != nil {
+		log.Printf("otel: failed to enable SDK metrics: %v", err)
+	}
+}
+
+// Processor считает созданные и завершенные span
+type Processor struct {
+	started metric.Int64Counter
+	ended   metric.Int64Counter
+}
+
+var _ sdktrace.SpanProcessor = (*Processor)(nil)
+
+// NewProcessor создает Processor с метриками из глобального MeterProvider
+func NewProcessor() (*Processor, error) {
+	meter := otel.Meter(scopeName)
+
+	started, err := meter.Int64Counter("tracing.pipeline.spans.started",
+		metric.WithDescription("Number of spans started."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	ended, err := meter.Int64Counter("tracing.pipeline.spans.ended",
+		metric.WithDescription("Number of spans ended."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Processor{started: started, ended: ended}, nil
+}
+
+func (p *Processor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.started.Add(ctx, 1, metric.WithAttributes(sampledAttr(s)))
+}
+
+func (p *Processor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.ended.Add(context.Background(), 1, metric.WithAttributes(sampledAttr(s)))
+}
+
+func (p *Processor) Shutdown(context.Context) error { return nil }
+
+func (p *Processor) ForceFlush(context.Context) error { return nil }
+
+func sampledAttr(s sdktrace.ReadOnlySpan) attribute.KeyValue {
+	return attribute.Bool("sampled", s.SpanContext().IsSampled())
+}
+
+// Exporter измеряет задержку и результат каждого экспорта вложенного экспортера
+type Exporter struct {
+	next     sdktrace.SpanExporter
+	exported metric.Int64Counter
+	failures metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+var _ sdktrace.SpanExporter = (*Exporter)(nil)
+
+// NewExporter оборачивает next с метриками из глобального MeterProvider
+func NewExporter(next sdktrace.SpanExporter) (*Exporter, error) {
+	meter := otel.Meter(scopeName)
+
+	exported, err := meter.Int64Counter("tracing.pipeline.spans.exported",
+		metric.WithDescription("Number of spans passed to the exporter, by outcome."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("tracing.pipeline.export.failures",
+		metric.WithDescription("Number of failed export calls."),
+		metric.WithUnit("{batch}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("tracing.pipeline.export.duration",
+		metric.WithDescription("Duration of export calls."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		next:     next,
+		exported: exported,
+		failures: failures,
+		duration: duration,
+	}, nil
+}
+
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.next.ExportSpans(ctx, spans)
+	elapsed := time.Since(start).Seconds()
+
+	// Метрики пишем в фоновом контексте: ctx экспорта может быть уже отменен
+	outcome := attribute.String("outcome", "success")
+	if err != nil {
+		outcome = attribute.String("outcome", "failure")
+		e.failures.Add(context.Background(), 1)
+	}
+	e.exported.Add(context.Background(), int64(len(spans)), metric.WithAttributes(outcome))
+	e.duration.Record(context.Background(), elapsed, metric.WithAttributes(outcome))
+
+	return err
+}
+
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
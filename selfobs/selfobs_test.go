@@ -0,0 +1,170 @@
+package selfobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/selfobs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useManualReader подменяет глобальный MeterProvider на время теста
+func useManualReader(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	prev := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(prev) })
+	return reader
+}
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	result := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			result[m.Name] = m.Data
+		}
+	}
+	return result
+}
+
+// sumBy возвращает значения счетчика по значению атрибута key
+func sumBy(t *testing.T, data metricdata.Aggregation, key attribute.Key) map[string]int64 {
+	t.Helper()
+	sum, ok := data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("metric data = %T, want int64 sum", data)
+	}
+	result := make(map[string]int64)
+	for _, dp := range sum.DataPoints {
+		v, _ := dp.Attributes.Value(key)
+		result[v.Emit()] += dp.Value
+	}
+	return result
+}
+
+// total возвращает сумму счетчика по всем атрибутам
+func total(t *testing.T, data metricdata.Aggregation) int64 {
+	t.Helper()
+	var n int64
+	for _, v := range sumBy(t, data, "") {
+		n += v
+	}
+	return n
+}
+
+// recordOnly записывает span, но не отправляет их дальше
+type recordOnly struct{}
+
+func (recordOnly) ShouldSample(sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return sdktrace.SamplingResult{Decision: sdktrace.RecordOnly}
+}
+
+func (recordOnly) Description() string { return "RecordOnly" }
+
+func TestProcessorCountsSpans(t *testing.T) {
+	reader := useManualReader(t)
+	p, err := selfobs.NewProcessor()
+	if err != nil {
+		t.Fatalf("NewProcessor() error = %v", err)
+	}
+
+	sampled := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p))
+	recorded := sdktrace.NewTracerProvider(sdktrace.WithSampler(recordOnly{}), sdktrace.WithSpanProcessor(p))
+	// Отброшенные семплером span до процессоров не доходят
+	dropped := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()), sdktrace.WithSpanProcessor(p))
+	for _, tp := range []*sdktrace.TracerProvider{sampled, sampled, recorded, dropped} {
+		_, span := tp.Tracer("test").Start(context.Background(), "op")
+		span.End()
+	}
+	// Незавершенный span учитывается только при старте
+	_, open := sampled.Tracer("test").Start(context.Background(), "open")
+	defer open.End()
+
+	metrics := collect(t, reader)
+	if got := sumBy(t, metrics["tracing.pipeline.spans.started"], "sampled"); got["true"] != 3 || got["false"] != 1 {
+		t.Errorf("spans.started by sampled = %v, want true=3 false=1", got)
+	}
+	if got := sumBy(t, metrics["tracing.pipeline.spans.ended"], "sampled"); got["true"] != 2 || got["false"] != 1 {
+		t.Errorf("spans.ended by sampled = %v, want true=2 false=1", got)
+	}
+}
+
+// failingExporter отклоняет пачки, пока fail выставлен
+type failingExporter struct {
+	fail bool
+}
+
+func (f *failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	if f.fail {
+		return errors.New("collector unreachable")
+	}
+	return nil
+}
+
+func (f *failingExporter) Shutdown(context.Context) error { return nil }
+
+func TestExporterRecordsOutcome(t *testing.T) {
+	reader := useManualReader(t)
+	next := &failingExporter{}
+	e, err := selfobs.NewExporter(next)
+	if err != nil {
+		t.Fatalf("NewExporter() error = %v", err)
+	}
+
+	spans := tracetest.SpanStubs{{Name: "a"}, {Name: "b"}, {Name: "c"}}.Snapshots()
+	if err := e.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatalf("ExportSpans() error = %v", err)
+	}
+	next.fail = true
+	if err := e.ExportSpans(context.Background(), spans[:1]); err == nil {
+		t.Fatal("ExportSpans() error = nil, want the wrapped exporter error")
+	}
+
+	metrics := collect(t, reader)
+	if got := sumBy(t, metrics["tracing.pipeline.spans.exported"], "outcome"); got["success"] != 3 || got["failure"] != 1 {
+		t.Errorf("spans.exported by outcome = %v, want success=3 failure=1", got)
+	}
+	if got := total(t, metrics["tracing.pipeline.export.failures"]); got != 1 {
+		t.Errorf("export.failures = %d, want 1", got)
+	}
+
+	hist, ok := metrics["tracing.pipeline.export.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("export.duration data = %T, want float64 histogram", metrics["tracing.pipeline.export.duration"])
+	}
+	counts := make(map[string]uint64)
+	for _, dp := range hist.DataPoints {
+		v, _ := dp.Attributes.Value("outcome")
+		counts[v.Emit()] += dp.Count
+	}
+	if counts["success"] != 1 || counts["failure"] != 1 {
+		t.Errorf("export.duration counts by outcome = %v, want one of each", counts)
+	}
+}
+
+func TestErrorHandlerCountsErrors(t *testing.T) {
+	reader := useManualReader(t)
+	prev := otel.GetErrorHandler()
+	t.Cleanup(func() { otel.SetErrorHandler(prev) })
+
+	selfobs.InstallErrorHandler()
+	otel.Handle(errors.New("export failed"))
+	otel.Handle(errors.New("export failed again"))
+
+	metrics := collect(t, reader)
+	if got := total(t, metrics["tracing.pipeline.errors"]); got != 2 {
+		t.Errorf("pipeline.errors = %d, want 2", got)
+	}
+}
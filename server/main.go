@@ -2,123 +2,280 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	rtrace "runtime/trace"
 	"time"
 
+	"github.com/DifferentialOrange/go-tracing-example/admin"
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
 	pb "github.com/DifferentialOrange/go-tracing-example/hello"
+	"github.com/DifferentialOrange/go-tracing-example/otelconfig"
+	"github.com/DifferentialOrange/go-tracing-example/repro"
+	"github.com/DifferentialOrange/go-tracing-example/sampling"
+	"github.com/DifferentialOrange/go-tracing-example/selfobs"
+	"github.com/DifferentialOrange/go-tracing-example/tailsampling"
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"github.com/DifferentialOrange/go-tracing-example/tracesetup"
+	"github.com/DifferentialOrange/go-tracing-example/zpages"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 type server struct {
 	pb.UnimplementedGreeterServer
 	tracer trace.Tracer
+	clock  repro.Clock
+	// rand выбирает медленные ответы; с -trace-seed выбор повторяется
+	rand *repro.Rand
+	// Доля медленных ответов и их задержка: хвост задержек, который
+	// сокращает hedging на клиенте
+	slowRatio   float64
+	slowLatency time.Duration
 }
 
-func initTracer(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
-	// Создаем OTEL exporter
-	exporter, err := otlptracehttp.New(ctx)
-	if err != nil {
-		return nil, err
-	}
+func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
+	// Создаем span для обработки запроса
+	ctx, span := s.tracer.Start(ctx, "SayHello", trace.WithTimestamp(s.clock.Now()))
+	defer func() { span.End(trace.WithTimestamp(s.clock.Now())) }()
+	// Область в трассе исполнения с тем же именем, что у span
+	defer rtrace.StartRegion(ctx, "SayHello").End()
 
-	// Создаем TracerProvider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(serviceName),
-		)),
-	)
+	// Добавляем атрибуты (заменяют SetTag); поля запроса записывает
+	// stats handler по опциям (trace.attribute) в proto/hello.proto
+	span.SetAttributes(attribute.String("grpc.method", "SayHello"))
 
-	// Устанавливаем глобальный TracerProvider и propagator
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
+	// Логируем событие (заменяет LogKV)
+	span.AddEvent("received request", trace.WithTimestamp(s.clock.Now()))
 
-	return tp, nil
-}
+	slog.Info("Received request", "name", req.Name)
 
-func extractSpanContext(ctx context.Context) context.Context {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return ctx
+	// Имитация работы; с -trace-seed часы просто сдвигаются
+	latency := 100 * time.Millisecond
+	if s.slowRatio > 0 && s.rand.Float64() < s.slowRatio {
+		latency = s.slowLatency
+		span.SetAttributes(attribute.Bool("greeter.slow", true))
 	}
+	s.clock.Sleep(latency)
 
-	// Извлекаем trace context из метаданных
-	carrier := metadataTextMap(md)
-	propagator := otel.GetTextMapPropagator()
-	return propagator.Extract(ctx, carrier)
+	// Логируем отправку ответа
+	span.AddEvent("sending response", trace.WithTimestamp(s.clock.Now()))
+	slog.Debug("Sending response", "trace_id", span.SpanContext().TraceID().String())
+
+	return &pb.HelloResponse{
+		Message: "Hello, " + req.Name + "! Welcome to gRPC server!",
+	}, nil
 }
 
-type metadataTextMap metadata.MD
+func startDebugServer(addr string, zp *zpages.SpanProcessor) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/tracez", zpages.Handler(zp))
+	// Профили размечены метками span_id и rpc.method, см. grpctrace.SpanIDLabel
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		log.Printf("Debug server started on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("debug server stopped: %v", err)
+		}
+	}()
+}
 
-func (m metadataTextMap) Get(key string) string {
-	values := m[key]
-	if len(values) == 0 {
-		return ""
+// envOr возвращает значение переменной окружения или def, если она не задана
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-	return values[0]
+	return def
 }
 
-func (m metadataTextMap) Set(key, value string) {
-	m[key] = []string{value}
+// isFlagSet сообщает, задан ли флаг в командной строке явно
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func (m metadataTextMap) Keys() []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+func main() {
+	debugAddr := flag.String("debug-addr", "", "address of the debug HTTP server with /debug/tracez, disabled when empty")
+	tenantSampling := flag.String("tenant-sampling", "", "per-tenant sampling ratios, e.g. acme=0.1,globex=1")
+	tenantResample := flag.Bool("tenant-resample-remote", false, "apply -tenant-sampling to calls from sampled or unsampled clients too, instead of keeping the client's decision")
+	tenantEndpoints := flag.String("tenant-endpoints", "", "per-tenant OTLP/HTTP trace endpoints, e.g. acme=http://localhost:4319/v1/traces")
+	methodPolicies := flag.String("method-policies", "", "JSON file with per-method tracing policies")
+	bufferDir := flag.String("span-buffer-dir", "", "directory to keep spans in while the collector is unreachable, disabled when empty")
+	capturePayloads := flag.Bool("capture-payloads", false, "record request and response messages as JSON span events")
+	payloadMaxSize := flag.Int("payload-max-size", grpctrace.DefaultPayloadMaxSize, "maximum size of a captured message in bytes")
+	redactFields := flag.String("redact-fields", "", "comma-separated message fields hidden in captured payloads and policy attributes, e.g. name,user.token")
+	traceSeed := flag.Int64("trace-seed", 0, "seed for reproducible trace ids and a simulated clock, random ids and real time when 0")
+	propagators := flag.String("propagators", envOr("OTEL_PROPAGATORS", "tracecontext,baggage"),
+		"trace context propagators: tracecontext, baggage, grpc-trace-bin; the first listed wins when a request carries several")
+	trustedNetworks := flag.String("trusted-networks", "", "comma-separated client networks whose trace context is trusted, e.g. 10.0.0.0/8,127.0.0.1")
+	trustedIdentities := flag.String("trusted-identities", "", "comma-separated mTLS client identities (CN, DNS or URI SAN) whose trace context is trusted")
+	requireAuth := flag.Bool("require-auth", false, "trust trace context only from clients that send the authorization header")
+	baggageAllowList := flag.String("baggage-allow-list", "", "comma-separated baggage keys accepted from untrusted clients")
+	otelConfig := flag.String("otel-config", os.Getenv("OTEL_CONFIG_FILE"), "declarative OpenTelemetry configuration file (YAML) used instead of the OTEL_EXPORTER_OTLP_* variables")
+	adminAddr := flag.String("admin-addr", "", "loopback address of the Admin gRPC service that changes sampling and log level at runtime, e.g. localhost:50052; the service has no authentication; disabled when empty")
+	samplingRatio := flag.Float64("sampling-ratio", 1, "sampling ratio for methods without a rule; can be changed through the Admin service")
+	samplingRules := flag.String("sampling-rules", "/admin.Admin/*=1", "per-method sampling ratios, e.g. /hello.Greeter/*=0.1; the first matching pattern wins")
+	slowRatio := flag.Float64("slow-ratio", 0, "fraction of SayHello calls answered after -slow-latency instead of 100ms")
+	slowLatency := flag.Duration("slow-latency", time.Second, "latency of slow SayHello calls")
+	instances := flag.Int("instances", 1, "number of server instances listening on consecutive ports starting from 50051")
+	logLevel := flag.String("log-level", "info", "level of structured log messages: debug, info, warn or error")
+	tailWait := flag.Duration("tail-sampling-wait", 0, "buffer spans per trace for this long and export only traces with errors, slow spans or matching attributes, disabled when 0")
+	tailLatency := flag.Duration("tail-latency-threshold", 0, "keep traces with a span longer than this, disabled when 0")
+	tailAttributes := flag.String("tail-attributes", "debug.trace", "comma-separated span attributes that keep a trace, key or key=value")
+	tailMaxSpans := flag.Int("tail-max-spans", tailsampling.DefaultMaxSpans, "maximum number of spans buffered for tail sampling")
+	debugTokens := flag.String("debug-tokens", os.Getenv("DEBUG_TRACE_TOKENS"), "comma-separated x-debug-trace values that force sampling of the whole trace")
+	debugAllowedNetworks := flag.String("debug-allowed-networks", "", "comma-separated client networks allowed to force sampling with any x-debug-trace value")
+	debugAllowedIdentities := flag.String("debug-allowed-identities", "", "comma-separated mTLS client identities allowed to force sampling with any x-debug-trace value")
+	flag.Parse()
+
+	// Ошибки SDK пишем в наш лог вместо глобального обработчика по умолчанию
+	selfobs.InstallErrorHandler()
+
+	level, err := admin.ParseLogLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid -log-level: %v", err)
 	}
-	return keys
-}
+	slog.SetLogLoggerLevel(level)
 
-func (s *server) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
-	// Извлекаем контекст трассировки
-	ctx = extractSpanContext(ctx)
+	// С seed идентификаторы и время span повторяются от запуска к запуску
+	tracerOpts, clock := repro.TracerProviderOptions(*traceSeed)
 
-	// Создаем span для обработки запроса
-	ctx, span := s.tracer.Start(ctx, "SayHello")
-	defer span.End()
+	// Опционально включаем отладочные страницы со span в памяти
+	if *debugAddr != "" {
+		zp := zpages.NewSpanProcessor(zpages.DefaultSampleSize)
+		tracerOpts = append(tracerOpts, sdktrace.WithSpanProcessor(zp))
+		startDebugServer(*debugAddr, zp)
+	}
 
-	// Добавляем атрибуты (заменяют SetTag)
-	span.SetAttributes(
-		attribute.String("request.name", req.Name),
-		attribute.String("grpc.method", "SayHello"),
-	)
+	// Арендатор из метаданных попадает во все span и влияет на семплирование
+	tenantRatios, err := tenant.ParseRatios(*tenantSampling)
+	if err != nil {
+		log.Fatalf("Invalid -tenant-sampling: %v", err)
+	}
+	tenantRoutes, err := tenant.ParseEndpoints(*tenantEndpoints)
+	if err != nil {
+		log.Fatalf("Invalid -tenant-endpoints: %v", err)
+	}
 
-	// Логируем событие (заменяет LogKV)
-	span.AddEvent("received request")
+	// Экспортеры, семплер и ресурс можно описать в файле вместо переменных окружения
+	var fileConfig *otelconfig.Config
+	if *otelConfig != "" {
+		fileConfig, err = otelconfig.Load(*otelConfig)
+		if err != nil {
+			log.Fatalf("Invalid -otel-config: %v", err)
+		}
+	}
 
-	log.Printf("Received request from: %s", req.Name)
+	// Долю и правила по методам можно менять на ходу через Admin; без него
+	// и без флагов семплирования остается семплер по умолчанию или из файла
+	rules, err := sampling.ParseRules(*samplingRules)
+	if err != nil {
+		log.Fatalf("Invalid -sampling-rules: %v", err)
+	}
+	dynamicSampler, err := sampling.NewSampler(sampling.Config{Ratio: *samplingRatio, Rules: rules})
+	if err != nil {
+		log.Fatalf("Invalid sampling settings: %v", err)
+	}
+	var sampler sdktrace.Sampler
+	if *adminAddr != "" || isFlagSet("sampling-ratio") || isFlagSet("sampling-rules") {
+		sampler = dynamicSampler
+	}
+	if len(tenantRatios) > 0 {
+		fallback := sampler
+		if fallback == nil {
+			fallback = sdktrace.AlwaysSample()
+		}
+		sampler = tenant.NewSampler(tenantRatios, fallback)
+	}
+	if sampler != nil {
+		if fileConfig != nil && fileConfig.Sampler() != nil {
+			log.Printf("-admin-addr, -sampling-* or -tenant-sampling is set, ignoring the sampler from -otel-config")
+		}
+		if *tenantResample {
+			sampler = tenant.ResampleRemote(sampler)
+		} else {
+			sampler = tenant.ParentBased(sampler)
+		}
+	} else if fileConfig != nil {
+		sampler = fileConfig.Sampler()
+	}
 
-	// Имитация работы
-	time.Sleep(100 * time.Millisecond)
+	// Проверенный флаг отладки семплирует trace поверх всех остальных правил
+	debugNetworks, err := grpctrace.ParseNetworks(tracesetup.SplitList(*debugAllowedNetworks))
+	if err != nil {
+		log.Fatalf("Invalid -debug-allowed-networks: %v", err)
+	}
+	debugPolicy := grpctrace.DebugPolicy{
+		Tokens:            tracesetup.SplitList(*debugTokens),
+		AllowedNetworks:   debugNetworks,
+		AllowedIdentities: tracesetup.SplitList(*debugAllowedIdentities),
+	}
+	debugEnabled := len(debugPolicy.Tokens) > 0 || len(debugPolicy.AllowedNetworks) > 0 || len(debugPolicy.AllowedIdentities) > 0
+	// Отметку отладки от доверенных сервисов принимаем и без своих токенов,
+	// чтобы флаг доходил до конца цепочки
+	debugEnabled = debugEnabled || len(tracesetup.SplitList(*trustedNetworks)) > 0 ||
+		len(tracesetup.SplitList(*trustedIdentities)) > 0 || *requireAuth
+	if debugEnabled {
+		if sampler == nil {
+			sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+		}
+		sampler = grpctrace.DebugSampler(sampler)
+	}
+	if sampler != nil {
+		tracerOpts = append(tracerOpts, sdktrace.WithSampler(sampler))
+	}
 
-	// Логируем отправку ответа
-	span.AddEvent("sending response")
+	// Старые сервисы передают контекст только в бинарном grpc-trace-bin
+	propagator, err := grpctrace.ParsePropagators(*propagators)
+	if err != nil {
+		log.Fatalf("Invalid -propagators: %v", err)
+	}
 
-	return &pb.HelloResponse{
-		Message: "Hello, " + req.Name + "! Welcome to gRPC server!",
-	}, nil
-}
+	// Хвостовое семплирование сохраняет trace с ошибками, медленные и отмеченные
+	var tail *tailsampling.Config
+	if *tailWait > 0 {
+		attributeRules, err := tailsampling.ParseAttributeRules(*tailAttributes)
+		if err != nil {
+			log.Fatalf("Invalid -tail-attributes: %v", err)
+		}
+		tail = &tailsampling.Config{
+			DecisionWait:     *tailWait,
+			LatencyThreshold: *tailLatency,
+			AttributeRules:   attributeRules,
+			MaxSpans:         *tailMaxSpans,
+		}
+	}
 
-func main() {
 	// Инициализируем tracer provider
-	tp, err := initTracer(context.Background(), "grpc-server")
+	tp, err := tracesetup.Init(context.Background(), tracesetup.Config{
+		ServiceName:     "grpc-server",
+		BufferDir:       *bufferDir,
+		FileConfig:      fileConfig,
+		Propagator:      propagator,
+		TenantEndpoints: tenantRoutes,
+		TailSampling:    tail,
+		Options:         tracerOpts,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize tracer: %v", err)
 	}
@@ -135,68 +292,119 @@ func main() {
 		trace.WithSchemaURL(semconv.SchemaURL),
 	)
 
-	lis, err := net.Listen("tcp", ":50051")
+	// Инициализируем meter provider и HTTP endpoint для метрик
+	mp, metricsHandler, err := initMeter(context.Background(), "grpc-server")
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatalf("Failed to initialize meter: %v", err)
 	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down meter provider: %v", err)
+		}
+	}()
 
-	srv := grpc.NewServer(
-		grpc.UnaryInterceptor(tracingUnaryInterceptor(tracer)),
-	)
+	metrics, err := grpctrace.NewServerMetrics(mp.Meter("grpc-server"))
+	if err != nil {
+		log.Fatalf("Failed to create metrics: %v", err)
+	}
 
-	server := &server{tracer: tracer}
-	pb.RegisterGreeterServer(srv, server)
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metricsHandler)
+		log.Println("Metrics server started on :9464")
+		if err := http.ListenAndServe(":9464", mux); err != nil {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
 
-	log.Println("Server started on :50051")
-	if err := srv.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	// Экземпляры слушают соседние порты, начиная с 50051; клиент распределяет
+	// между ними вызовы (см. -target и -lb клиента)
+	if *instances < 1 {
+		log.Fatalf("Invalid -instances: %d", *instances)
+	}
+	listeners := make([]net.Listener, *instances)
+	for i := range listeners {
+		listeners[i], err = net.Listen("tcp", fmt.Sprintf(":%d", 50051+i))
+		if err != nil {
+			log.Fatalf("failed to listen: %v", err)
+		}
 	}
-}
 
-func tracingUnaryInterceptor(tracer trace.Tracer) grpc.UnaryServerInterceptor {
-	return func(
-		ctx context.Context,
-		req interface{},
-		info *grpc.UnaryServerInfo,
-		handler grpc.UnaryHandler,
-	) (interface{}, error) {
-		// Извлекаем контекст трассировки из метаданных
-		ctx = extractSpanContext(ctx)
-
-		// Создаем span для gRPC метода
-		ctx, span := tracer.Start(ctx, info.FullMethod,
-			trace.WithSpanKind(trace.SpanKindServer),
-		)
-		defer span.End()
-
-		// Добавляем атрибуты gRPC
-		span.SetAttributes(
-			attribute.String("rpc.system", "grpc"),
-			attribute.String("rpc.service", "Greeter"),
-			attribute.String("rpc.method", info.FullMethod),
-			attribute.String("grpc.type", "unary"),
-		)
+	// Политики по методам: что трассировать и какие поля сообщений записывать
+	policies := grpctrace.DefaultPolicies
+	if *methodPolicies != "" {
+		policies, err = grpctrace.LoadPolicies(*methodPolicies)
+		if err != nil {
+			log.Fatalf("Failed to load method policies: %v", err)
+		}
+	}
+
+	traceOpts := []grpctrace.Option{grpctrace.WithPolicies(policies), grpctrace.WithClock(clock)}
+
+	// Контекст трассировки недоверенных клиентов не продолжается, а связывается ссылкой
+	networks, err := grpctrace.ParseNetworks(tracesetup.SplitList(*trustedNetworks))
+	if err != nil {
+		log.Fatalf("Invalid -trusted-networks: %v", err)
+	}
+	trust := grpctrace.TrustPolicy{
+		TrustedIdentities: tracesetup.SplitList(*trustedIdentities),
+		TrustedNetworks:   networks,
+		RequireAuth:       *requireAuth,
+		BaggageAllowList:  tracesetup.SplitList(*baggageAllowList),
+	}
+	if len(trust.TrustedIdentities) > 0 || len(trust.TrustedNetworks) > 0 || trust.RequireAuth {
+		traceOpts = append(traceOpts, grpctrace.WithTrustPolicy(trust))
+	}
+	if debugEnabled {
+		traceOpts = append(traceOpts, grpctrace.WithDebugPolicy(debugPolicy))
+	}
+	// Скрытые поля не попадают ни в события, ни в атрибуты политик
+	capture := tracesetup.PayloadCapture(*payloadMaxSize, *redactFields)
+	traceOpts = append(traceOpts, grpctrace.WithRedactFields(capture.Redact...))
+	if *capturePayloads {
+		traceOpts = append(traceOpts, grpctrace.WithPayloadCapture(capture))
+	}
+
+	srv := grpc.NewServer(
+		grpc.StatsHandler(grpctrace.NewServerHandler(tracer, metrics, traceOpts...)),
+		grpc.UnaryInterceptor(grpctrace.StatsServerInterceptor()),
+	)
 
-		// Обрабатываем запрос
-		resp, err := handler(ctx, req)
+	server := &server{tracer: tracer, clock: clock, rand: repro.NewRand(*traceSeed), slowRatio: *slowRatio, slowLatency: *slowLatency}
+	pb.RegisterGreeterServer(srv, server)
 
-		// Обрабатываем ошибку, если есть
+	// Admin слушает отдельный адрес, чтобы его не было видно клиентам Greeter
+	if *adminAddr != "" {
+		adminLis, err := net.Listen("tcp", *adminAddr)
 		if err != nil {
-			span.SetStatus(codes.Error, err.Error())
-			if s, ok := status.FromError(err); ok {
-				span.SetAttributes(
-					attribute.Int("rpc.grpc.status_code", int(s.Code())),
-					attribute.String("rpc.grpc.status_message", s.Message()),
-				)
-			}
-			span.RecordError(err)
-		} else {
-			span.SetStatus(codes.Ok, "success")
-			span.SetAttributes(
-				attribute.Int("rpc.grpc.status_code", 0), // OK
-			)
+			log.Fatalf("failed to listen on admin address: %v", err)
+		}
+		// У Admin нет аутентификации: любой, кто до него достучится, может
+		// включить запись всех запросов
+		if ip, ok := adminLis.Addr().(*net.TCPAddr); ok && !ip.IP.IsLoopback() {
+			log.Printf("WARNING: -admin-addr %s is not a loopback address, the Admin service has no authentication", *adminAddr)
 		}
+		adminSrv := grpc.NewServer(
+			grpc.StatsHandler(grpctrace.NewServerHandler(tracer, metrics, traceOpts...)),
+			grpc.UnaryInterceptor(grpctrace.StatsServerInterceptor()),
+		)
+		admin.RegisterAdminServer(adminSrv, admin.NewService(dynamicSampler))
+		go func() {
+			log.Printf("Admin server started on %s", *adminAddr)
+			if err := adminSrv.Serve(adminLis); err != nil {
+				log.Printf("admin server stopped: %v", err)
+			}
+		}()
+	}
 
-		return resp, err
+	// Один grpc.Server обслуживает все адреса: span различаются атрибутом
+	// net.sock.host.addr
+	errs := make(chan error, len(listeners))
+	for i, lis := range listeners {
+		go func() {
+			log.Printf("Server started on :%d", 50051+i)
+			errs <- srv.Serve(lis)
+		}()
 	}
+	log.Fatalf("failed to serve: %v", <-errs)
 }
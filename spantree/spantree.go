@@ -0,0 +1,199 @@
+// Package spantree превращает записанные span в детерминированное дерево:
+// идентификаторы и время отбрасываются, атрибуты сортируются. Это позволяет
+// сравнивать трассировку с эталонными golden файлами в тестах.
+package spantree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Node — span без идентификаторов и времени вместе с дочерними span
+type Node struct {
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"`
+	Status     string      `json:"status"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+	Events     []Event     `json:"events,omitempty"`
+	Links      int         `json:"links,omitempty"`
+	// RemoteParent отмечает span, родитель которого пришел по сети
+	RemoteParent bool    `json:"remote_parent,omitempty"`
+	Children     []*Node `json:"children,omitempty"`
+
+	start int64
+}
+
+// Attribute — атрибут в виде строки с указанием исходного типа
+type Attribute struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Event — событие span без времени
+type Event struct {
+	Name       string      `json:"name"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+// Build строит лес span по связям родитель-потомок. Корнями становятся span
+// без родителя или с родителем, которого нет среди spans.
+func Build(spans []sdktrace.ReadOnlySpan) []*Node {
+	nodes := make(map[trace.SpanID]*Node, len(spans))
+	for _, s := range spans {
+		nodes[s.SpanContext().SpanID()] = newNode(s)
+	}
+
+	var roots []*Node
+	for _, s := range spans {
+		node := nodes[s.SpanContext().SpanID()]
+		parent, ok := nodes[s.Parent().SpanID()]
+		if !s.Parent().IsValid() || !ok {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	sortNodes(roots)
+	return roots
+}
+
+func newNode(s sdktrace.ReadOnlySpan) *Node {
+	node := &Node{
+		Name:         s.Name(),
+		Kind:         s.SpanKind().String(),
+		Status:       s.Status().Code.String(),
+		Attributes:   attributes(s.Attributes()),
+		Links:        len(s.Links()),
+		RemoteParent: s.Parent().IsRemote(),
+		start:        s.StartTime().UnixNano(),
+	}
+	if s.Status().Description != "" {
+		node.Status += ": " + s.Status().Description
+	}
+	for _, e := range s.Events() {
+		node.Events = append(node.Events, Event{
+			Name:       e.Name,
+			Attributes: attributes(e.Attributes),
+		})
+	}
+	return node
+}
+
+func attributes(kvs []attribute.KeyValue) []Attribute {
+	if len(kvs) == 0 {
+		return nil
+	}
+	result := make([]Attribute, 0, len(kvs))
+	for _, kv := range kvs {
+		result = append(result, Attribute{
+			Key:   string(kv.Key),
+			Type:  kv.Value.Type().String(),
+			Value: kv.Value.Emit(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// sortNodes упорядочивает потомков по имени и типу, а одинаковые — по
+// времени начала, чтобы порядок не зависел от порядка завершения span
+func sortNodes(nodes []*Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.start < b.start
+	})
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+}
+
+// JSON возвращает дерево в виде отформатированного JSON
+func JSON(roots []*Node) ([]byte, error) {
+	data, err := json.MarshalIndent(roots, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Text возвращает дерево в виде текста с отступами, удобного для чтения диффов
+func Text(roots []*Node) string {
+	var b strings.Builder
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		indent := strings.Repeat("  ", depth)
+		fmt.Fprintf(&b, "%s%s [%s] %s\n", indent, n.Name, n.Kind, n.Status)
+		for _, a := range n.Attributes {
+			fmt.Fprintf(&b, "%s  %s=%s\n", indent, a.Key, a.Value)
+		}
+		for _, e := range n.Events {
+			fmt.Fprintf(&b, "%s  event %s", indent, e.Name)
+			for _, a := range e.Attributes {
+				fmt.Fprintf(&b, " %s=%s", a.Key, a.Value)
+			}
+			b.WriteString("\n")
+		}
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	for _, r := range roots {
+		walk(r, 0)
+	}
+	return b.String()
+}
+
+// AssertGolden сравнивает дерево spans с файлом testdata/<name>.golden.json.
+// При update файл перезаписывается текущим результатом.
+func AssertGolden(t testing.TB, name string, spans []sdktrace.ReadOnlySpan, update bool) {
+	t.Helper()
+
+	roots := Build(spans)
+	got, err := JSON(roots)
+	if err != nil {
+		t.Fatalf("failed to marshal span tree: %v", err)
+	}
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		var wantRoots []*Node
+		wantText := string(want)
+		if err := json.Unmarshal(want, &wantRoots); err == nil {
+			wantText = Text(wantRoots)
+		}
+		t.Errorf("span tree does not match %s (run with -update to accept)\ngot:\n%s\nwant:\n%s",
+			path, Text(roots), wantText)
+	}
+}
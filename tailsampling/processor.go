@@ -0,0 +1,405 @@
+// Package tailsampling содержит SpanProcessor, который решает судьбу trace
+// целиком после его завершения: span копятся по trace заданное время, а затем
+// trace с ошибками, медленными span или нужными атрибутами передается дальше,
+// остальные отбрасываются. Так сохраняются как раз те trace, которые
+// головное семплирование с малой долей чаще всего теряет.
+package tailsampling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Значения Config по умолчанию
+const (
+	DefaultDecisionWait = 5 * time.Second
+	DefaultMaxTraces    = 10000
+	DefaultMaxSpans     = 100000
+)
+
+// Причины решения в метрике tailsampling.traces.decided
+const (
+	ReasonError     = "error"
+	ReasonLatency   = "latency"
+	ReasonAttribute = "attribute"
+	ReasonNone      = "none"
+)
+
+// AttributeRule сохраняет trace, у одного из span которого есть атрибут Key
+// со значением Value; пустое Value подходит под любое значение
+type AttributeRule struct {
+	Key   string
+	Value string
+}
+
+// ParseAttributeRules разбирает правила вида "rpc.grpc.status_code=13,debug.trace"
+func ParseAttributeRules(s string) ([]AttributeRule, error) {
+	var rules []AttributeRule
+	if strings.TrimSpace(s) == "" {
+		return rules, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid attribute rule %q, expected key or key=value", item)
+		}
+		rules = append(rules, AttributeRule{Key: key, Value: value})
+	}
+	return rules, nil
+}
+
+func (r AttributeRule) match(attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if string(kv.Key) == r.Key {
+			return r.Value == "" || kv.Value.Emit() == r.Value
+		}
+	}
+	return false
+}
+
+// Config задает окно ожидания, правила и ограничения памяти
+type Config struct {
+	// DecisionWait — сколько ждать span trace после первого завершенного,
+	// прежде чем принять решение
+	DecisionWait time.Duration
+	// LatencyThreshold — trace сохраняется, если какой-то span длился
+	// дольше; 0 отключает проверку
+	LatencyThreshold time.Duration
+	// AttributeRules — trace сохраняется, если подходит хотя бы одно правило
+	AttributeRules []AttributeRule
+	// MaxTraces и MaxSpans ограничивают буфер. При переполнении решение по
+	// самым старым trace принимается досрочно по уже полученным span.
+	MaxTraces int
+	MaxSpans  int
+	// MeterProvider для метрик решений, по умолчанию глобальный
+	MeterProvider metric.MeterProvider
+}
+
+// Processor буферизует завершенные span по trace и передает во вложенные
+// процессоры только сохраненные trace. OnStart вложенных процессоров не
+// вызывается, поэтому годятся процессоры, которым нужен только OnEnd, как
+// BatchSpanProcessor. Решать нечего, если span не записаны, так что головной
+// семплер должен записывать все span, которые могут понадобиться.
+type Processor struct {
+	next []sdktrace.SpanProcessor
+	cfg  Config
+
+	mu      sync.Mutex
+	pending map[trace.TraceID]*pendingTrace
+	// order — trace в порядке появления; решенные trace удаляются лениво
+	order []*pendingTrace
+	spans int
+	// decided помнит недавние решения для span, завершившихся после решения
+	decided *decisionCache
+
+	decisions    metric.Int64Counter
+	evicted      metric.Int64Counter
+	registration metric.Registration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+var _ sdktrace.SpanProcessor = (*Processor)(nil)
+
+type pendingTrace struct {
+	id     trace.TraceID
+	first  time.Time
+	spans  []sdktrace.ReadOnlySpan
+	reason string
+	done   bool
+}
+
+// New создает Processor, который передает сохраненные trace в next
+func New(cfg Config, next ...sdktrace.SpanProcessor) (*Processor, error) {
+	if cfg.DecisionWait <= 0 {
+		cfg.DecisionWait = DefaultDecisionWait
+	}
+	if cfg.MaxTraces <= 0 {
+		cfg.MaxTraces = DefaultMaxTraces
+	}
+	if cfg.MaxSpans <= 0 {
+		cfg.MaxSpans = DefaultMaxSpans
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+
+	p := &Processor{
+		next:    next,
+		cfg:     cfg,
+		pending: make(map[trace.TraceID]*pendingTrace),
+		decided: newDecisionCache(cfg.MaxTraces),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := p.registerMetrics(); err != nil {
+		return nil, fmt.Errorf("tailsampling: %w", err)
+	}
+
+	go p.decideLoop()
+
+	return p, nil
+}
+
+func (p *Processor) registerMetrics() error {
+	meter := p.cfg.MeterProvider.Meter("github.com/DifferentialOrange/go-tracing-example/tailsampling")
+
+	var err error
+	p.decisions, err = meter.Int64Counter("tailsampling.traces.decided",
+		metric.WithDescription("Number of traces decided, by decision and the reason a trace was kept."),
+		metric.WithUnit("{trace}"),
+	)
+	if err != nil {
+		return err
+	}
+	p.evicted, err = meter.Int64Counter("tailsampling.traces.evicted",
+		metric.WithDescription("Number of traces decided early because the buffer was full."),
+		metric.WithUnit("{trace}"),
+	)
+	if err != nil {
+		return err
+	}
+	bufferedTraces, err := meter.Int64ObservableUpDownCounter("tailsampling.traces.buffered",
+		metric.WithDescription("Number of traces waiting for a decision."),
+		metric.WithUnit("{trace}"),
+	)
+	if err != nil {
+		return err
+	}
+	bufferedSpans, err := meter.Int64ObservableUpDownCounter("tailsampling.spans.buffered",
+		metric.WithDescription("Number of spans waiting for a decision."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		p.mu.Lock()
+		traces, spans := len(p.pending), p.spans
+		p.mu.Unlock()
+		o.ObserveInt64(bufferedTraces, int64(traces))
+		o.ObserveInt64(bufferedSpans, int64(spans))
+		return nil
+	}, bufferedTraces, bufferedSpans)
+	return err
+}
+
+func (p *Processor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd добавляет span в буфер его trace. Span уже решенного trace сразу
+// передается дальше или отбрасывается по тому же решению.
+func (p *Processor) OnEnd(s sdktrace.ReadOnlySpan) {
+	id := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	if keep, ok := p.decided.get(id); ok {
+		p.mu.Unlock()
+		if keep {
+			p.export([]sdktrace.ReadOnlySpan{s})
+		}
+		return
+	}
+
+	t, ok := p.pending[id]
+	if !ok {
+		t = &pendingTrace{id: id, first: time.Now()}
+		p.pending[id] = t
+		p.order = append(p.order, t)
+	}
+	t.spans = append(t.spans, s)
+	p.spans++
+	if t.reason == "" {
+		t.reason = p.evaluate(s)
+	}
+
+	// При переполнении досрочно решаем самые старые trace
+	var ready []*pendingTrace
+	for len(p.pending) > p.cfg.MaxTraces || p.spans > p.cfg.MaxSpans {
+		oldest := p.popOldest()
+		if oldest == nil {
+			break
+		}
+		ready = append(ready, oldest)
+	}
+	p.mu.Unlock()
+
+	if len(ready) > 0 {
+		p.evicted.Add(context.Background(), int64(len(ready)))
+		p.finish(ready)
+	}
+}
+
+// evaluate возвращает причину сохранить trace по одному span или ""
+func (p *Processor) evaluate(s sdktrace.ReadOnlySpan) string {
+	if s.Status().Code == codes.Error {
+		return ReasonError
+	}
+	if p.cfg.LatencyThreshold > 0 && s.EndTime().Sub(s.StartTime()) > p.cfg.LatencyThreshold {
+		return ReasonLatency
+	}
+	for _, rule := range p.cfg.AttributeRules {
+		if rule.match(s.Attributes()) {
+			return ReasonAttribute
+		}
+	}
+	return ""
+}
+
+// popOldest снимает с очереди самый старый нерешенный trace; вызывается под mu
+func (p *Processor) popOldest() *pendingTrace {
+	for len(p.order) > 0 {
+		t := p.order[0]
+		p.order[0] = nil
+		p.order = p.order[1:]
+		if !t.done {
+			p.take(t)
+			return t
+		}
+	}
+	return nil
+}
+
+// take убирает trace из буфера и запоминает решение; вызывается под mu
+func (p *Processor) take(t *pendingTrace) {
+	t.done = true
+	delete(p.pending, t.id)
+	p.spans -= len(t.spans)
+	p.decided.put(t.id, t.reason != "")
+}
+
+// expired снимает с очереди trace, ожидание которых истекло к now
+func (p *Processor) expired(now time.Time) []*pendingTrace {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ready []*pendingTrace
+	for len(p.order) > 0 {
+		t := p.order[0]
+		if !t.done && now.Sub(t.first) < p.cfg.DecisionWait {
+			break
+		}
+		p.order[0] = nil
+		p.order = p.order[1:]
+		if !t.done {
+			p.take(t)
+			ready = append(ready, t)
+		}
+	}
+	return ready
+}
+
+// finish передает дальше сохраненные trace и записывает решения в метрики
+func (p *Processor) finish(traces []*pendingTrace) {
+	for _, t := range traces {
+		decision, reason := "dropped", ReasonNone
+		if t.reason != "" {
+			decision, reason = "sampled", t.reason
+			p.export(t.spans)
+		}
+		p.decisions.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("decision", decision),
+			attribute.String("reason", reason),
+		))
+	}
+}
+
+func (p *Processor) export(spans []sdktrace.ReadOnlySpan) {
+	for _, next := range p.next {
+		for _, s := range spans {
+			next.OnEnd(s)
+		}
+	}
+}
+
+func (p *Processor) decideLoop() {
+	defer close(p.done)
+
+	// Проверяем чаще окна, чтобы решение не запаздывало больше чем на пятую часть
+	interval := p.cfg.DecisionWait / 5
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			p.finish(p.expired(now))
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// ForceFlush сбрасывает вложенные процессоры. Trace, ожидающие решения,
+// остаются в буфере: решать по ним раньше времени значит потерять их span.
+func (p *Processor) ForceFlush(ctx context.Context) error {
+	var err error
+	for _, next := range p.next {
+		err = errors.Join(err, next.ForceFlush(ctx))
+	}
+	return err
+}
+
+// Shutdown принимает решение по всем ожидающим trace и останавливает
+// вложенные процессоры
+func (p *Processor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+
+	p.mu.Lock()
+	var ready []*pendingTrace
+	for t := p.popOldest(); t != nil; t = p.popOldest() {
+		ready = append(ready, t)
+	}
+	p.mu.Unlock()
+	p.finish(ready)
+
+	err := p.registration.Unregister()
+	for _, next := range p.next {
+		err = errors.Join(err, next.Shutdown(ctx))
+	}
+	return err
+}
+
+// decisionCache — решения по последним size trace
+type decisionCache struct {
+	size      int
+	decisions map[trace.TraceID]bool
+	order     []trace.TraceID
+}
+
+func newDecisionCache(size int) *decisionCache {
+	return &decisionCache{size: size, decisions: make(map[trace.TraceID]bool, size)}
+}
+
+func (c *decisionCache) get(id trace.TraceID) (keep, ok bool) {
+	keep, ok = c.decisions[id]
+	return keep, ok
+}
+
+func (c *decisionCache) put(id trace.TraceID, keep bool) {
+	if _, ok := c.decisions[id]; !ok {
+		if len(c.order) >= c.size {
+			delete(c.decisions, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, id)
+	}
+	c.decisions[id] = keep
+}
@@ -0,0 +1,202 @@
+package tailsampling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type testEnv struct {
+	processor *Processor
+	recorder  *tracetest.SpanRecorder
+	reader    *sdkmetric.ManualReader
+	tracer    trace.Tracer
+}
+
+func newTestEnv(t *testing.T, cfg Config) *testEnv {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	cfg.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	recorder := tracetest.NewSpanRecorder()
+	processor, err := New(cfg, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	return &testEnv{processor: processor, recorder: recorder, reader: reader, tracer: tp.Tracer("tailsampling-test")}
+}
+
+// startTrace создает корневой span с одним потомком, которого настраивает child
+func (e *testEnv) startTrace(child func(trace.Span)) trace.Span {
+	ctx, root := e.tracer.Start(context.Background(), "root")
+	_, span := e.tracer.Start(ctx, "child")
+	child(span)
+	span.End()
+	return root
+}
+
+func (e *testEnv) waitForSpans(t *testing.T, n int) []sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if ended := e.recorder.Ended(); len(ended) >= n {
+			return ended
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d exported spans, want %d", len(e.recorder.Ended()), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// decided возвращает число решений по паре decision/reason
+func (e *testEnv) decided(t *testing.T) map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := e.reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				key := m.Name
+				if v, ok := dp.Attributes.Value("decision"); ok {
+					reason, _ := dp.Attributes.Value("reason")
+					key = v.AsString() + "/" + reason.AsString()
+				}
+				got[key] = dp.Value
+			}
+		}
+	}
+	return got
+}
+
+func TestKeepsInterestingTraces(t *testing.T) {
+	env := newTestEnv(t, Config{
+		DecisionWait:     50 * time.Millisecond,
+		LatencyThreshold: time.Second,
+		AttributeRules:   []AttributeRule{{Key: "debug.trace"}},
+	})
+
+	start := time.Now()
+	traces := []struct {
+		name  string
+		child func(trace.Span)
+	}{
+		{"ok", func(trace.Span) {}},
+		{"error", func(s trace.Span) { s.SetStatus(codes.Error, "boom") }},
+		{"attribute", func(s trace.Span) { s.SetAttributes(attribute.Bool("debug.trace", true)) }},
+	}
+	kept := make(map[trace.TraceID]string)
+	for _, tt := range traces {
+		root := env.startTrace(tt.child)
+		root.End()
+		if tt.name != "ok" {
+			kept[root.SpanContext().TraceID()] = tt.name
+		}
+	}
+	// Медленный span: время задаем явно, чтобы не ждать секунду
+	_, slow := env.tracer.Start(context.Background(), "slow", trace.WithTimestamp(start))
+	slow.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+	kept[slow.SpanContext().TraceID()] = "latency"
+
+	spans := env.waitForSpans(t, 5)
+	time.Sleep(100 * time.Millisecond)
+	if got := len(env.recorder.Ended()); got != 5 {
+		t.Fatalf("exported %d spans, want 5", got)
+	}
+	for _, s := range spans {
+		if _, ok := kept[s.SpanContext().TraceID()]; !ok {
+			t.Errorf("span %s of a dropped trace was exported", s.Name())
+		}
+	}
+
+	want := map[string]int64{"dropped/none": 1, "sampled/error": 1, "sampled/attribute": 1, "sampled/latency": 1}
+	got := env.decided(t)
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("decisions %s = %d, want %d (all: %v)", k, got[k], v, got)
+		}
+	}
+}
+
+func TestWaitsForWholeTrace(t *testing.T) {
+	env := newTestEnv(t, Config{DecisionWait: time.Hour})
+
+	// Ошибка в потомке сохраняет и корневой span, завершенный позже
+	root := env.startTrace(func(s trace.Span) { s.SetStatus(codes.Error, "boom") })
+	root.End()
+	if got := len(env.recorder.Ended()); got != 0 {
+		t.Fatalf("exported %d spans before the decision", got)
+	}
+
+	// Shutdown решает по всем ожидающим trace
+	if err := env.processor.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(env.recorder.Ended()); got != 2 {
+		t.Errorf("exported %d spans after shutdown, want 2", got)
+	}
+}
+
+func TestLateSpanFollowsDecision(t *testing.T) {
+	env := newTestEnv(t, Config{DecisionWait: 20 * time.Millisecond})
+
+	ctx, root := env.tracer.Start(context.Background(), "root")
+	_, failed := env.tracer.Start(ctx, "failed")
+	failed.SetStatus(codes.Error, "boom")
+	failed.End()
+	env.waitForSpans(t, 1)
+
+	// Корневой span закончился после решения и уходит следом
+	root.End()
+	env.waitForSpans(t, 2)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	env := newTestEnv(t, Config{DecisionWait: time.Hour, MaxTraces: 1})
+
+	failed := env.startTrace(func(s trace.Span) { s.SetStatus(codes.Error, "boom") })
+	failed.End()
+	// Второй trace вытесняет первый, и решение по нему принимается сразу
+	ok := env.startTrace(func(trace.Span) {})
+	ok.End()
+
+	env.waitForSpans(t, 2)
+	got := env.decided(t)
+	if got["tailsampling.traces.evicted"] != 1 || got["sampled/error"] != 1 {
+		t.Errorf("metrics = %v, want one evicted and sampled trace", got)
+	}
+}
+
+func TestParseAttributeRules(t *testing.T) {
+	rules, err := ParseAttributeRules("rpc.grpc.status_code=13, debug.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AttributeRule{{Key: "rpc.grpc.status_code", Value: "13"}, {Key: "debug.trace"}}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("ParseAttributeRules() = %v, want %v", rules, want)
+	}
+	if _, err := ParseAttributeRules("=1"); err == nil {
+		t.Error("ParseAttributeRules() without key succeeded")
+	}
+}
@@ -0,0 +1,106 @@
+// Package tenant переносит идентификатор арендатора (tenant) между сервисами
+// и использует его в трассировке: добавляет атрибут tenant.id ко всем span,
+// задает долю семплирования для каждого арендатора и направляет span разных
+// арендаторов в разные экспортеры.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// MetadataKey — заголовок gRPC с идентификатором арендатора
+	MetadataKey = "x-tenant-id"
+	// BaggageKey — элемент baggage с идентификатором арендатора
+	BaggageKey = "tenant.id"
+	// AttributeKey — атрибут span с идентификатором арендатора
+	AttributeKey = attribute.Key("tenant.id")
+)
+
+type contextKey struct{}
+
+// ContextWithTenant сохраняет арендатора в ctx и в baggage, чтобы он
+// передавался дальше вместе с контекстом трассировки
+func ContextWithTenant(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, contextKey{}, id)
+
+	member, err := baggage.NewMember(BaggageKey, id)
+	if err != nil {
+		log.Printf("tenant: invalid tenant id %q for baggage: %v", id, err)
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		log.Printf("tenant: failed to set baggage: %v", err)
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// FromContext возвращает арендатора из ctx, а если его там нет — из baggage
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok {
+		return id
+	}
+	return baggage.FromContext(ctx).Member(BaggageKey).Value()
+}
+
+// FromIncomingContext возвращает арендатора из входящих метаданных, а если
+// заголовка нет — из baggage, уже извлеченного propagator в ctx
+func FromIncomingContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return baggage.FromContext(ctx).Member(BaggageKey).Value()
+}
+
+// ParseRatios разбирает доли семплирования вида "acme=0.1,globex=1"
+func ParseRatios(s string) (map[string]float64, error) {
+	pairs, err := parsePairs(s)
+	if err != nil {
+		return nil, err
+	}
+
+	ratios := make(map[string]float64, len(pairs))
+	for id, value := range pairs {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("tenant %q: sampling ratio must be a number in [0, 1], got %q", id, value)
+		}
+		ratios[id] = ratio
+	}
+	return ratios, nil
+}
+
+// ParseEndpoints разбирает адреса экспорта вида "acme=http://host:4318/v1/traces"
+func ParseEndpoints(s string) (map[string]string, error) {
+	return parsePairs(s)
+}
+
+func parsePairs(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return pairs, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		id, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || id == "" || value == "" {
+			return nil, fmt.Errorf("invalid tenant setting %q, expected tenant=value", item)
+		}
+		pairs[id] = value
+	}
+	return pairs, nil
+}
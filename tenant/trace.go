@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// AttributeProcessor добавляет tenant.id к каждому span, в контексте
+// которого известен арендатор
+type AttributeProcessor struct{}
+
+var _ sdktrace.SpanProcessor = AttributeProcessor{}
+
+func (AttributeProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if id := FromContext(ctx); id != "" {
+		s.SetAttributes(AttributeKey.String(id))
+	}
+}
+
+func (AttributeProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (AttributeProcessor) Shutdown(context.Context) error { return nil }
+
+func (AttributeProcessor) ForceFlush(context.Context) error { return nil }
+
+// Sampler семплирует span с долей, заданной для арендатора; для неизвестных
+// арендаторов и запросов без арендатора используется fallback
+type Sampler struct {
+	samplers map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = (*Sampler)(nil)
+
+// NewSampler создает Sampler с долями ratios
+func NewSampler(ratios map[string]float64, fallback sdktrace.Sampler) *Sampler {
+	samplers := make(map[string]sdktrace.Sampler, len(ratios))
+	for id, ratio := range ratios {
+		samplers[id] = sdktrace.TraceIDRatioBased(ratio)
+	}
+	return &Sampler{samplers: samplers, fallback: fallback}
+}
+
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	id := FromContext(p.ParentContext)
+	if id == "" {
+		// Атрибут мог быть передан при создании span
+		for _, kv := range p.Attributes {
+			if kv.Key == AttributeKey {
+				id = kv.Value.AsString()
+				break
+			}
+		}
+	}
+	if sampler, ok := s.samplers[id]; ok {
+		return sampler.ShouldSample(p)
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *Sampler) Description() string {
+	return fmt.Sprintf("TenantSampler{tenants=%d,fallback=%s}", len(s.samplers), s.fallback.Description())
+}
+
+// RoutingProcessor передает завершенные span в процессор их арендатора,
+// а span без арендатора или без отдельного маршрута — в fallback
+type RoutingProcessor struct {
+	routes   map[string]sdktrace.SpanProcessor
+	fallback sdktrace.SpanProcessor
+}
+
+var _ sdktrace.SpanProcessor = (*RoutingProcessor)(nil)
+
+// NewRoutingProcessor создает RoutingProcessor. Атрибут tenant.id должен
+// появиться у span раньше, поэтому AttributeProcessor нужно
+// зарегистрировать в TracerProvider до него.
+func NewRoutingProcessor(fallback sdktrace.SpanProcessor, routes map[string]sdktrace.SpanProcessor) *RoutingProcessor {
+	return &RoutingProcessor{routes: routes, fallback: fallback}
+}
+
+func (p *RoutingProcessor) route(s sdktrace.ReadOnlySpan) sdktrace.SpanProcessor {
+	for _, kv := range s.Attributes() {
+		if kv.Key == AttributeKey {
+			if route, ok := p.routes[kv.Value.AsString()]; ok {
+				return route
+			}
+			break
+		}
+	}
+	return p.fallback
+}
+
+func (p *RoutingProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	p.route(s).OnStart(ctx, s)
+}
+
+func (p *RoutingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.route(s).OnEnd(s)
+}
+
+func (p *RoutingProcessor) Shutdown(ctx context.Context) error {
+	return p.each(func(sp sdktrace.SpanProcessor) error { return sp.Shutdown(ctx) })
+}
+
+func (p *RoutingProcessor) ForceFlush(ctx context.Context) error {
+	return p.each(func(sp sdktrace.SpanProcessor) error { return sp.ForceFlush(ctx) })
+}
+
+func (p *RoutingProcessor) each(fn func(sdktrace.SpanProcessor) error) error {
+	err := fn(p.fallback)
+	for _, route := range p.routes {
+		err = errors.Join(err, fn(route))
+	}
+	return err
+}
+
+// ParentBased оборачивает sampler так, что потомки, локальные и удаленные,
+// наследуют решение родителя, а доля арендатора применяется только к корням
+// trace. Так trace не обрывается посередине, если сервисы по-разному
+// семплируют одного арендатора.
+func ParentBased(sampler sdktrace.Sampler) sdktrace.Sampler {
+	return sdktrace.ParentBased(sampler)
+}
+
+// ResampleRemote оборачивает sampler так, что локальные потомки наследуют
+// решение родителя, а для удаленного родителя решение принимается заново:
+// сервер применяет свою долю арендатора независимо от клиента. Trace,
+// который клиент семплировал, а сервер нет, обрывается на сервере, поэтому
+// это поведение включается явно.
+func ResampleRemote(sampler sdktrace.Sampler) sdktrace.Sampler {
+	return sdktrace.ParentBased(sampler,
+		sdktrace.WithRemoteParentSampled(sampler),
+		sdktrace.WithRemoteParentNotSampled(sampler),
+	)
+}
@@ -0,0 +1,171 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSampler(t *testing.T) {
+	sampler := tenant.NewSampler(map[string]float64{"acme": 1, "globex": 0}, sdktrace.NeverSample())
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler))
+	tracer := tp.Tracer("tenant-test")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts []trace.SpanStartOption
+		want bool
+	}{
+		{name: "ratio 1", ctx: tenant.ContextWithTenant(context.Background(), "acme"), want: true},
+		{name: "ratio 0", ctx: tenant.ContextWithTenant(context.Background(), "globex"), want: false},
+		{name: "unknown tenant uses fallback", ctx: tenant.ContextWithTenant(context.Background(), "initech"), want: false},
+		{name: "no tenant uses fallback", ctx: context.Background(), want: false},
+		{
+			name: "tenant from start attributes",
+			ctx:  context.Background(),
+			opts: []trace.SpanStartOption{trace.WithAttributes(tenant.AttributeKey.String("acme"))},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, span := tracer.Start(tt.ctx, "op", tt.opts...)
+			defer span.End()
+			if got := span.SpanContext().IsSampled(); got != tt.want {
+				t.Errorf("sampled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParentBased(t *testing.T) {
+	remote := func(id string, flags trace.TraceFlags) context.Context {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		})
+		return trace.ContextWithRemoteSpanContext(tenant.ContextWithTenant(context.Background(), id), sc)
+	}
+	ratios := tenant.NewSampler(map[string]float64{"acme": 1, "globex": 0}, sdktrace.AlwaysSample())
+
+	tests := []struct {
+		name    string
+		sampler sdktrace.Sampler
+		ctx     context.Context
+		want    bool
+	}{
+		{name: "root uses tenant ratio", sampler: tenant.ParentBased(ratios), ctx: tenant.ContextWithTenant(context.Background(), "globex"), want: false},
+		// Решение клиента сохраняется, даже если доля арендатора другая
+		{name: "sampled remote parent", sampler: tenant.ParentBased(ratios), ctx: remote("globex", trace.FlagsSampled), want: true},
+		{name: "unsampled remote parent", sampler: tenant.ParentBased(ratios), ctx: remote("acme", 0), want: false},
+		{name: "resample sampled remote parent", sampler: tenant.ResampleRemote(ratios), ctx: remote("globex", trace.FlagsSampled), want: false},
+		{name: "resample unsampled remote parent", sampler: tenant.ResampleRemote(ratios), ctx: remote("acme", 0), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSampler(tt.sampler)).Tracer("tenant-test")
+			_, span := tracer.Start(tt.ctx, "server")
+			defer span.End()
+			if got := span.SpanContext().IsSampled(); got != tt.want {
+				t.Errorf("sampled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Локальный потомок наследует решение родителя в обоих режимах
+	for _, sampler := range []sdktrace.Sampler{tenant.ParentBased(ratios), tenant.ResampleRemote(ratios)} {
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSampler(sampler)).Tracer("tenant-test")
+		ctx, parent := tracer.Start(tenant.ContextWithTenant(context.Background(), "acme"), "parent")
+		_, child := tracer.Start(tenant.ContextWithTenant(ctx, "globex"), "child")
+		if !parent.SpanContext().IsSampled() || !child.SpanContext().IsSampled() {
+			t.Errorf("%s: parent sampled = %v, child sampled = %v; want both sampled",
+				sampler.Description(), parent.SpanContext().IsSampled(), child.SpanContext().IsSampled())
+		}
+		child.End()
+		parent.End()
+	}
+}
+
+func TestRoutingProcessor(t *testing.T) {
+	fallback := newRecorder()
+	acme := newRecorder()
+	router := tenant.NewRoutingProcessor(fallback, map[string]sdktrace.SpanProcessor{"acme": acme})
+
+	// AttributeProcessor зарегистрирован первым, и маршрут известен уже в OnStart
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(tenant.AttributeProcessor{}),
+		sdktrace.WithSpanProcessor(router),
+	)
+	tracer := tp.Tracer("tenant-test")
+
+	for _, id := range []string{"acme", "globex", ""} {
+		_, span := tracer.Start(tenant.ContextWithTenant(context.Background(), id), "op-"+id)
+		span.End()
+	}
+
+	names := func(r *recorder) (started, ended []string) {
+		for _, s := range r.Started() {
+			started = append(started, s.Name())
+		}
+		for _, s := range r.Ended() {
+			ended = append(ended, s.Name())
+		}
+		return started, ended
+	}
+	if started, ended := names(acme); len(started) != 1 || len(ended) != 1 || ended[0] != "op-acme" {
+		t.Errorf("acme route got started %v, ended %v; want op-acme only", started, ended)
+	}
+	if started, ended := names(fallback); len(started) != 2 || len(ended) != 2 {
+		t.Errorf("fallback got started %v, ended %v; want op-globex and op-", started, ended)
+	}
+
+	// Shutdown доходит до всех маршрутов
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if !fallback.shutdown || !acme.shutdown {
+		t.Errorf("shutdown fallback = %v, acme = %v; want both", fallback.shutdown, acme.shutdown)
+	}
+}
+
+// recorder запоминает span и вызов Shutdown
+type recorder struct {
+	*tracetest.SpanRecorder
+	shutdown bool
+}
+
+func newRecorder() *recorder {
+	return &recorder{SpanRecorder: tracetest.NewSpanRecorder()}
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+	r.shutdown = true
+	return r.SpanRecorder.Shutdown(ctx)
+}
+
+func TestAttributeProcessor(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(tenant.AttributeProcessor{}),
+		sdktrace.WithSpanProcessor(rec),
+	)
+	_, span := tp.Tracer("tenant-test").Start(tenant.ContextWithTenant(context.Background(), "acme"), "op")
+	span.End()
+
+	var got string
+	for _, kv := range rec.Ended()[0].Attributes() {
+		if kv.Key == tenant.AttributeKey {
+			got = kv.Value.AsString()
+		}
+	}
+	if got != "acme" {
+		t.Errorf("tenant.id = %q, want acme", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Package tracesetup собирает TracerProvider клиента и сервера: OTLP экспорт
+// по переменным окружения OTEL_EXPORTER_OTLP_* или по файлу otelconfig,
+// самонаблюдение экспорта, дисковый буфер, маршрутизацию по арендаторам и
+// tail sampling. Здесь же разбор общих для обоих бинарников флагов.
+package tracesetup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/DifferentialOrange/go-tracing-example/diskbuffer"
+	"github.com/DifferentialOrange/go-tracing-example/grpctrace"
+	"github.com/DifferentialOrange/go-tracing-example/otelconfig"
+	"github.com/DifferentialOrange/go-tracing-example/selfobs"
+	"github.com/DifferentialOrange/go-tracing-example/tailsampling"
+	"github.com/DifferentialOrange/go-tracing-example/tenant"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// Config — настройки TracerProvider
+type Config struct {
+	ServiceName string
+	// BufferDir — каталог, в который сохраняются пачки span, не отправленные
+	// экспортером; пустой отключает буфер
+	BufferDir string
+	// FileConfig — разобранный файл конфигурации; без него экспортер
+	// настраивается переменными окружения
+	FileConfig *otelconfig.Config
+	// Propagator устанавливается глобально, если файл не задает свой
+	Propagator propagation.TextMapPropagator
+	// TenantEndpoints — адреса коллекторов отдельных арендаторов
+	TenantEndpoints map[string]string
+	// TailSampling откладывает решение о trace до его завершения
+	TailSampling *tailsampling.Config
+	// Options применяются после файла конфигурации и переопределяют его
+	Options []sdktrace.TracerProviderOption
+}
+
+// Init создает TracerProvider по cfg и устанавливает его и propagator
+// глобально
+func Init(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	// Каждый экспортер измеряет задержку и ошибки самого OTLP экспорта, а пачки,
+	// которые не удалось отправить, сохраняет на диск в dir
+	wrapTo := func(exporter sdktrace.SpanExporter, dir string) (sdktrace.SpanExporter, error) {
+		exporter, err := selfobs.NewExporter(exporter)
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			return exporter, nil
+		}
+		return diskbuffer.New(exporter, diskbuffer.Config{Dir: dir})
+	}
+	buffered := 0
+	wrap := func(exporter sdktrace.SpanExporter) (sdktrace.SpanExporter, error) {
+		// Один каталог буфера не может обслуживать несколько экспортеров
+		if cfg.BufferDir != "" {
+			if buffered++; buffered > 1 {
+				return nil, errors.New("span buffer supports only one exporter")
+			}
+		}
+		return wrapTo(exporter, cfg.BufferDir)
+	}
+
+	spanCounter, err := selfobs.NewProcessor()
+	if err != nil {
+		return nil, err
+	}
+
+	// Метрики SDK нужно включить до создания batcher
+	selfobs.EnableSDKMetrics()
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	)
+	baseOpts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	propagator := cfg.Propagator
+	var processors []sdktrace.SpanProcessor
+	if cfg.FileConfig == nil {
+		// Создаем OTEL exporter по переменным окружения OTEL_EXPORTER_OTLP_*
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := wrap(exporter)
+		if err != nil {
+			return nil, err
+		}
+		processors = append(processors, sdktrace.NewBatchSpanProcessor(wrapped))
+	} else {
+		// Процессоры, ресурс, семплер и лимиты берем из файла; cfg.Options
+		// применяются после них и переопределяют файл
+		if processors, err = cfg.FileConfig.SpanProcessors(ctx, wrap); err != nil {
+			return nil, err
+		}
+		if baseOpts, err = cfg.FileConfig.TracerProviderOptions(res); err != nil {
+			return nil, err
+		}
+		filePropagator, ok, err := cfg.FileConfig.TextMapPropagator()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			propagator = filePropagator
+		}
+	}
+
+	// Span отдельных арендаторов отправляем в их собственные коллекторы
+	if len(cfg.TenantEndpoints) > 0 {
+		if len(processors) != 1 {
+			return nil, fmt.Errorf("tenant endpoints need exactly one span processor, got %d", len(processors))
+		}
+		routes := make(map[string]sdktrace.SpanProcessor, len(cfg.TenantEndpoints))
+		for id, endpoint := range cfg.TenantEndpoints {
+			tenantExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+			if err != nil {
+				return nil, fmt.Errorf("tenant %q exporter: %w", id, err)
+			}
+			// Буфер арендатора — в своем подкаталоге, рядом с общим
+			dir := ""
+			if cfg.BufferDir != "" {
+				if !filepath.IsLocal(id) || strings.ContainsAny(id, `/\`) {
+					return nil, fmt.Errorf("tenant %q cannot be used as a buffer directory name", id)
+				}
+				dir = filepath.Join(cfg.BufferDir, "tenants", id)
+			}
+			wrapped, err := wrapTo(tenantExporter, dir)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %q exporter: %w", id, err)
+			}
+			routes[id] = sdktrace.NewBatchSpanProcessor(wrapped)
+		}
+		processors[0] = tenant.NewRoutingProcessor(processors[0], routes)
+	}
+
+	// Решение о trace откладываем до его завершения, чтобы не терять ошибки и
+	// медленные запросы
+	if cfg.TailSampling != nil {
+		tailProcessor, err := tailsampling.New(*cfg.TailSampling, processors...)
+		if err != nil {
+			return nil, err
+		}
+		processors = []sdktrace.SpanProcessor{tailProcessor}
+	}
+
+	// Создаем TracerProvider
+	// tenant.id должен появиться у span раньше, чем его увидят остальные
+	// процессоры, в том числе маршрутизация по арендаторам
+	tpOpts := append(baseOpts,
+		sdktrace.WithSpanProcessor(tenant.AttributeProcessor{}),
+		sdktrace.WithSpanProcessor(spanCounter),
+	)
+	for _, processor := range processors {
+		tpOpts = append(tpOpts, sdktrace.WithSpanProcessor(processor))
+	}
+	tpOpts = append(tpOpts, cfg.Options...)
+	// disabled: true в файле отключает трассировку независимо от флагов
+	if cfg.FileConfig != nil && cfg.FileConfig.Disabled {
+		tpOpts = append(tpOpts, sdktrace.WithSampler(sdktrace.NeverSample()))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+
+	// Устанавливаем глобальный TracerProvider и propagator
+	otel.SetTracerProvider(tp)
+	if propagator != nil {
+		otel.SetTextMapPropagator(propagator)
+	}
+
+	return tp, nil
+}
+
+// PayloadCapture собирает настройки записи сообщений из флагов: предела
+// размера и списка полей через запятую
+func PayloadCapture(maxSize int, redactFields string) grpctrace.PayloadCapture {
+	return grpctrace.PayloadCapture{MaxSize: maxSize, Redact: SplitList(redactFields)}
+}
+
+// SplitList разбирает список через запятую, пропуская пустые элементы
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,117 @@
+package tracesetup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DifferentialOrange/go-tracing-example/otelconfig"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSplitList(t *testing.T) {
+	got := SplitList(" a, ,b ,,c")
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitList() = %q, want %q", got, want)
+	}
+	if got := SplitList(""); got != nil {
+		t.Errorf("SplitList(\"\") = %q, want nil", got)
+	}
+}
+
+func parseConfig(t *testing.T, data string) *otelconfig.Config {
+	t.Helper()
+	cfg, err := otelconfig.Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return cfg
+}
+
+func TestInitDisabled(t *testing.T) {
+	tp, err := Init(context.Background(), Config{
+		ServiceName: "test",
+		FileConfig: parseConfig(t, `
+file_format: "0.3"
+disabled: true
+tracer_provider:
+  processors:
+    - simple:
+        exporter:
+          console: {}`),
+		Propagator: propagation.TraceContext{},
+	})
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+	if span.SpanContext().IsSampled() {
+		t.Error("span is sampled with disabled: true in the file")
+	}
+}
+
+func TestInitTenantBuffer(t *testing.T) {
+	dir := t.TempDir()
+	tp, err := Init(context.Background(), Config{
+		ServiceName:     "test",
+		BufferDir:       dir,
+		TenantEndpoints: map[string]string{"acme": "http://localhost:4318/v1/traces"},
+	})
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	if _, err := os.Stat(filepath.Join(dir, "tenants", "acme")); err != nil {
+		t.Errorf("tenant buffer directory: %v", err)
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	twoExporters := `
+file_format: "0.3"
+tracer_provider:
+  processors:
+    - simple:
+        exporter:
+          console: {}
+    - simple:
+        exporter:
+          console: {}`
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{
+			name:    "buffer with two exporters",
+			cfg:     Config{BufferDir: t.TempDir(), FileConfig: parseConfig(t, twoExporters)},
+			wantErr: "span buffer supports only one exporter",
+		},
+		{
+			name:    "tenant id outside the buffer",
+			cfg:     Config{BufferDir: t.TempDir(), TenantEndpoints: map[string]string{"../acme": "http://localhost:4318"}},
+			wantErr: `tenant "../acme" cannot be used as a buffer directory name`,
+		},
+		{
+			name:    "tenant endpoints with two processors",
+			cfg:     Config{FileConfig: parseConfig(t, twoExporters), TenantEndpoints: map[string]string{"acme": "http://localhost:4318"}},
+			wantErr: "tenant endpoints need exactly one span processor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Init(context.Background(), tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Init() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
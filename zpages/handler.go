@@ -0,0 +1,178 @@
+package zpages
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Handler отдает страницу /debug/tracez: без параметров — сводную таблицу,
+// с параметрами name и type (active, latency, error) — список span.
+// Параметр format=json переключает ответ в JSON.
+func Handler(p *SpanProcessor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name := q.Get("name")
+
+		var page tracezPage
+		page.Bounds = boundLabels()
+		if name == "" {
+			page.Summaries = p.Summaries()
+		} else {
+			page.Name = name
+			page.Type = q.Get("type")
+			switch page.Type {
+			case "active":
+				page.Spans = spanViews(p.ActiveSpans(name))
+			case "error":
+				page.Spans = spanViews(p.ErrorSpans(name))
+			default:
+				page.Type = "latency"
+				page.Bucket, _ = strconv.Atoi(q.Get("bucket"))
+				if page.Bucket < 0 || page.Bucket >= len(LatencyBounds) {
+					page.Bucket = 0
+				}
+				page.Spans = spanViews(p.LatencySpans(name, page.Bucket))
+			}
+		}
+
+		if q.Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(page); err != nil {
+				log.Printf("tracez: failed to write response: %v", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tracezTemplate.Execute(w, page); err != nil {
+			log.Printf("tracez: failed to render page: %v", err)
+		}
+	})
+}
+
+type tracezPage struct {
+	Bounds    []string   `json:"latency_buckets"`
+	Summaries []Summary  `json:"summaries,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Type      string     `json:"type,omitempty"`
+	Bucket    int        `json:"bucket,omitempty"`
+	Spans     []spanView `json:"spans,omitempty"`
+}
+
+type spanView struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_span_id,omitempty"`
+	Kind       string            `json:"kind"`
+	Start      time.Time         `json:"start"`
+	Duration   string            `json:"duration"`
+	Status     string            `json:"status"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []eventView       `json:"events,omitempty"`
+}
+
+type eventView struct {
+	Time       time.Time         `json:"time"`
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func spanViews(spans []sdktrace.ReadOnlySpan) []spanView {
+	views := make([]spanView, 0, len(spans))
+	for _, s := range spans {
+		// У активных span время завершения еще не задано
+		duration := time.Since(s.StartTime())
+		if !s.EndTime().IsZero() {
+			duration = s.EndTime().Sub(s.StartTime())
+		}
+
+		view := spanView{
+			TraceID:    s.SpanContext().TraceID().String(),
+			SpanID:     s.SpanContext().SpanID().String(),
+			Kind:       s.SpanKind().String(),
+			Start:      s.StartTime(),
+			Duration:   duration.String(),
+			Status:     s.Status().Code.String(),
+			Attributes: make(map[string]string),
+		}
+		if s.Parent().IsValid() {
+			view.ParentID = s.Parent().SpanID().String()
+		}
+		if s.Status().Description != "" {
+			view.Status += ": " + s.Status().Description
+		}
+		for _, kv := range s.Attributes() {
+			view.Attributes[string(kv.Key)] = kv.Value.Emit()
+		}
+		for _, e := range s.Events() {
+			ev := eventView{Time: e.Time, Name: e.Name, Attributes: make(map[string]string)}
+			for _, kv := range e.Attributes {
+				ev.Attributes[string(kv.Key)] = kv.Value.Emit()
+			}
+			view.Events = append(view.Events, ev)
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+func boundLabels() []string {
+	labels := make([]string, len(LatencyBounds))
+	for i, b := range LatencyBounds {
+		labels[i] = ">=" + b.String()
+	}
+	return labels
+}
+
+var tracezTemplate = template.Must(template.New("tracez").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>tracez</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+{{if .Name}}
+<h1>{{.Name}}: {{.Type}}{{if eq .Type "latency"}} {{index .Bounds .Bucket}}{{end}}</h1>
+<p><a href="?">&larr; all spans</a></p>
+<table>
+<tr><th>Start</th><th>Duration</th><th>Trace ID</th><th>Span ID</th><th>Parent</th><th>Kind</th><th>Status</th><th>Attributes</th><th>Events</th></tr>
+{{range .Spans}}
+<tr>
+<td>{{.Start.Format "15:04:05.000000"}}</td><td>{{.Duration}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td><td>{{.ParentID}}</td><td>{{.Kind}}</td><td>{{.Status}}</td>
+<td>{{range $k, $v := .Attributes}}{{$k}}={{$v}}<br>{{end}}</td>
+<td>{{range .Events}}{{.Time.Format "15:04:05.000000"}} {{.Name}}{{range $k, $v := .Attributes}} {{$k}}={{$v}}{{end}}<br>{{end}}</td>
+</tr>
+{{else}}
+<tr><td colspan="9">no spans</td></tr>
+{{end}}
+</table>
+{{else}}
+<h1>tracez</h1>
+<table>
+<tr><th>Span name</th><th>Active</th>{{range .Bounds}}<th>{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range .Summaries}}
+{{$name := .Name}}
+<tr>
+<td>{{.Name}}</td>
+<td><a href="?name={{.Name}}&type=active">{{.Active}}</a></td>
+{{range $i, $n := .Latency}}<td><a href="?name={{$name}}&type=latency&bucket={{$i}}">{{$n}}</a></td>{{end}}
+<td><a href="?name={{.Name}}&type=error">{{.Errors}}</a></td>
+</tr>
+{{else}}
+<tr><td colspan="{{len .Bounds}}">no spans yet</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,242 @@
+// Package zpages реализует отладочные страницы в духе OpenCensus zPages:
+// span processor хранит активные и недавно завершенные span в памяти,
+// а HTTP handler показывает их без внешнего коллектора.
+package zpages
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LatencyBounds — нижние границы бакетов задержки завершенных span
+var LatencyBounds = []time.Duration{
+	0,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	100 * time.Second,
+}
+
+// DefaultSampleSize — сколько span хранится в каждом бакете по умолчанию
+const DefaultSampleSize = 10
+
+// MaxSpanNames — сколько разных имен span процессор учитывает отдельно.
+// Имена с идентификаторами внутри иначе растили бы память без предела,
+// поэтому span с новыми именами сверх лимита попадают в OtherSpanName.
+const MaxSpanNames = 256
+
+// OtherSpanName — общая строка для span, имена которых не поместились в лимит
+const OtherSpanName = "other"
+
+// SpanProcessor запоминает активные span и последние завершенные span
+// для каждого имени отдельно по бакетам задержки и по ошибкам.
+type SpanProcessor struct {
+	sampleSize int
+
+	mu    sync.Mutex
+	names map[string]*spanSet
+	// started — набор, в который попал активный span в OnStart: имя span
+	// может измениться через SetName до его завершения
+	started map[trace.SpanID]*spanSet
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// NewSpanProcessor создает процессор, хранящий до sampleSize span в каждом бакете
+func NewSpanProcessor(sampleSize int) *SpanProcessor {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &SpanProcessor{
+		sampleSize: sampleSize,
+		names:      make(map[string]*spanSet),
+		started:    make(map[trace.SpanID]*spanSet),
+	}
+}
+
+type spanSet struct {
+	active  map[trace.SpanID]sdktrace.ReadOnlySpan
+	latency []*ring
+	errors  *ring
+	// Полное число завершенных span по бакетам, а не только сохраненных
+	latencyCount []int
+	errorCount   int
+}
+
+func (p *SpanProcessor) set(name string) *spanSet {
+	set, ok := p.names[name]
+	if !ok && len(p.names) >= MaxSpanNames {
+		name = OtherSpanName
+		set, ok = p.names[name]
+	}
+	if !ok {
+		set = &spanSet{
+			active:       make(map[trace.SpanID]sdktrace.ReadOnlySpan),
+			latency:      make([]*ring, len(LatencyBounds)),
+			errors:       newRing(p.sampleSize),
+			latencyCount: make([]int, len(LatencyBounds)),
+		}
+		for i := range set.latency {
+			set.latency[i] = newRing(p.sampleSize)
+		}
+		p.names[name] = set
+	}
+	return set
+}
+
+// OnStart добавляет span в список активных
+func (p *SpanProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := s.SpanContext().SpanID()
+	set := p.set(s.Name())
+	set.active[id] = s
+	p.started[id] = set
+}
+
+// OnEnd переносит span из активных в бакет задержки или ошибок. Завершенный
+// span учитывается под своим последним именем.
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := s.SpanContext().SpanID()
+	if started, ok := p.started[id]; ok {
+		delete(started.active, id)
+		delete(p.started, id)
+	}
+
+	set := p.set(s.Name())
+
+	if s.Status().Code == codes.Error {
+		set.errors.add(s)
+		set.errorCount++
+		return
+	}
+
+	i := latencyBucket(s.EndTime().Sub(s.StartTime()))
+	set.latency[i].add(s)
+	set.latencyCount[i]++
+}
+
+// Shutdown ничего не делает: данные живут только в памяти
+func (p *SpanProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush ничего не делает: процессор ничего не экспортирует
+func (p *SpanProcessor) ForceFlush(context.Context) error { return nil }
+
+func latencyBucket(d time.Duration) int {
+	i := sort.Search(len(LatencyBounds), func(i int) bool {
+		return LatencyBounds[i] > d
+	})
+	return i - 1
+}
+
+// Summary — счетчики span одного имени
+type Summary struct {
+	Name    string `json:"name"`
+	Active  int    `json:"active"`
+	Latency []int  `json:"latency"`
+	Errors  int    `json:"errors"`
+}
+
+// Summaries возвращает счетчики по всем именам span, отсортированные по имени
+func (p *SpanProcessor) Summaries() []Summary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]Summary, 0, len(p.names))
+	for name, set := range p.names {
+		result = append(result, Summary{
+			Name:    name,
+			Active:  len(set.active),
+			Latency: append([]int(nil), set.latencyCount...),
+			Errors:  set.errorCount,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+// ActiveSpans возвращает незавершенные span с заданным именем
+func (p *SpanProcessor) ActiveSpans(name string) []sdktrace.ReadOnlySpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set, ok := p.names[name]
+	if !ok {
+		return nil
+	}
+	spans := make([]sdktrace.ReadOnlySpan, 0, len(set.active))
+	for _, s := range set.active {
+		spans = append(spans, s)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].StartTime().Before(spans[j].StartTime()) })
+
+	return spans
+}
+
+// LatencySpans возвращает последние успешные span из бакета задержки bucket
+func (p *SpanProcessor) LatencySpans(name string, bucket int) []sdktrace.ReadOnlySpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set, ok := p.names[name]
+	if !ok || bucket < 0 || bucket >= len(set.latency) {
+		return nil
+	}
+	return set.latency[bucket].list()
+}
+
+// ErrorSpans возвращает последние span, завершившиеся ошибкой
+func (p *SpanProcessor) ErrorSpans(name string) []sdktrace.ReadOnlySpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set, ok := p.names[name]
+	if !ok {
+		return nil
+	}
+	return set.errors.list()
+}
+
+// ring — кольцевой буфер фиксированного размера
+type ring struct {
+	spans []sdktrace.ReadOnlySpan
+	next  int
+}
+
+func newRing(size int) *ring {
+	return &ring{spans: make([]sdktrace.ReadOnlySpan, 0, size)}
+}
+
+func (r *ring) add(s sdktrace.ReadOnlySpan) {
+	if len(r.spans) < cap(r.spans) {
+		r.spans = append(r.spans, s)
+		return
+	}
+	r.spans[r.next] = s
+	r.next = (r.next + 1) % len(r.spans)
+}
+
+// list возвращает содержимое буфера от новых span к старым
+func (r *ring) list() []sdktrace.ReadOnlySpan {
+	n := len(r.spans)
+	result := make([]sdktrace.ReadOnlySpan, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, r.spans[(r.next-i+n)%n])
+	}
+	return result
+}
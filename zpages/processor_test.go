@@ -0,0 +1,171 @@
+package zpages_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DifferentialOrange/go-tracing-example/zpages"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracer(t *testing.T, sampleSize int) (trace.Tracer, *zpages.SpanProcessor) {
+	t.Helper()
+	zp := zpages.NewSpanProcessor(sampleSize)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(zp))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp.Tracer("zpages-test"), zp
+}
+
+// endSpan завершает span с именем name длительностью d
+func endSpan(tracer trace.Tracer, name string, d time.Duration, err error) {
+	start := time.Now()
+	_, span := tracer.Start(context.Background(), name, trace.WithTimestamp(start))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(start.Add(d)))
+}
+
+func summary(t *testing.T, zp *zpages.SpanProcessor, name string) zpages.Summary {
+	t.Helper()
+	for _, s := range zp.Summaries() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no summary for %q in %v", name, zp.Summaries())
+	return zpages.Summary{}
+}
+
+func TestSpanProcessorBuckets(t *testing.T) {
+	tracer, zp := newTracer(t, 2)
+
+	_, active := tracer.Start(context.Background(), "call")
+	endSpan(tracer, "call", 5*time.Millisecond, nil)
+	endSpan(tracer, "call", 5*time.Millisecond, nil)
+	endSpan(tracer, "call", 5*time.Millisecond, nil)
+	endSpan(tracer, "call", 2*time.Second, nil)
+	endSpan(tracer, "call", time.Millisecond, errors.New("boom"))
+
+	s := summary(t, zp, "call")
+	if s.Active != 1 {
+		t.Errorf("active = %d, want 1", s.Active)
+	}
+	// 5ms попадает в бакет >=1ms, 2s — в бакет >=1s
+	if s.Latency[3] != 3 || s.Latency[6] != 1 {
+		t.Errorf("latency counts = %v, want 3 in bucket 3 and 1 in bucket 6", s.Latency)
+	}
+	if s.Errors != 1 {
+		t.Errorf("errors = %d, want 1", s.Errors)
+	}
+
+	// Счетчик полный, а хранятся только последние sampleSize span
+	if n := len(zp.LatencySpans("call", 3)); n != 2 {
+		t.Errorf("stored latency spans = %d, want 2", n)
+	}
+	if n := len(zp.ErrorSpans("call")); n != 1 {
+		t.Errorf("stored error spans = %d, want 1", n)
+	}
+	if spans := zp.ActiveSpans("call"); len(spans) != 1 || spans[0].SpanContext().SpanID() != active.SpanContext().SpanID() {
+		t.Errorf("active spans = %v, want the unfinished span", spans)
+	}
+
+	active.End()
+	if s := summary(t, zp, "call"); s.Active != 0 {
+		t.Errorf("active after End = %d, want 0", s.Active)
+	}
+}
+
+func TestSpanProcessorNameLimit(t *testing.T) {
+	tracer, zp := newTracer(t, 1)
+
+	for i := 0; i < zpages.MaxSpanNames+10; i++ {
+		endSpan(tracer, "span-"+strconv.Itoa(i), 0, nil)
+	}
+	// Уже известное имя продолжает учитываться отдельно
+	endSpan(tracer, "span-0", 0, nil)
+
+	summaries := zp.Summaries()
+	if len(summaries) != zpages.MaxSpanNames+1 {
+		t.Fatalf("got %d span names, want %d", len(summaries), zpages.MaxSpanNames+1)
+	}
+	if s := summary(t, zp, zpages.OtherSpanName); s.Latency[0] != 10 {
+		t.Errorf("%s latency counts = %v, want 10 in bucket 0", zpages.OtherSpanName, s.Latency)
+	}
+	if s := summary(t, zp, "span-0"); s.Latency[0] != 2 {
+		t.Errorf("span-0 latency counts = %v, want 2 in bucket 0", s.Latency)
+	}
+
+	// Активный span сверх лимита уходит из активных при завершении
+	_, span := tracer.Start(context.Background(), "late")
+	if s := summary(t, zp, zpages.OtherSpanName); s.Active != 1 {
+		t.Errorf("%s active = %d, want 1", zpages.OtherSpanName, s.Active)
+	}
+	span.End()
+	if s := summary(t, zp, zpages.OtherSpanName); s.Active != 0 {
+		t.Errorf("%s active after End = %d, want 0", zpages.OtherSpanName, s.Active)
+	}
+}
+
+func TestSpanProcessorRename(t *testing.T) {
+	tracer, zp := newTracer(t, 2)
+
+	_, span := tracer.Start(context.Background(), "before")
+	span.SetName("after")
+	span.End()
+
+	if s := summary(t, zp, "before"); s.Active != 0 {
+		t.Errorf("active under the start name = %d, want 0", s.Active)
+	}
+	if got := zp.ActiveSpans("before"); len(got) != 0 {
+		t.Errorf("ActiveSpans(before) = %d spans, want none", len(got))
+	}
+	s := summary(t, zp, "after")
+	finished := 0
+	for _, n := range s.Latency {
+		finished += n
+	}
+	if s.Active != 0 || finished != 1 {
+		t.Errorf("summary under the final name = %+v, want one finished span", s)
+	}
+}
+
+func TestHandlerJSON(t *testing.T) {
+	tracer, zp := newTracer(t, 0)
+	endSpan(tracer, "call", time.Millisecond, errors.New("boom"))
+
+	var page struct {
+		Summaries []zpages.Summary `json:"summaries"`
+		Spans     []struct {
+			Status string `json:"status"`
+		} `json:"spans"`
+	}
+	get := func(url string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		zpages.Handler(zp).ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != 200 {
+			t.Fatalf("GET %s: status %d", url, rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+	}
+
+	get("/debug/tracez?format=json")
+	if len(page.Summaries) != 1 || page.Summaries[0].Name != "call" || page.Summaries[0].Errors != 1 {
+		t.Errorf("summaries = %+v, want one error for call", page.Summaries)
+	}
+
+	get("/debug/tracez?format=json&name=call&type=error")
+	if len(page.Spans) != 1 || page.Spans[0].Status != "Error: boom" {
+		t.Errorf("error spans = %+v, want one with status Error: boom", page.Spans)
+	}
+}